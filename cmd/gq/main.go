@@ -4,15 +4,22 @@ Copyright © 2026 Joao Pargana jmpargana@gmail.com
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/jmpargana/gq/internal/cmd"
 )
 
 func Execute() {
-	err := cmd.RootCmd.Execute()
+	args, err := cmd.JoinNamedArgs(os.Args[1:])
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(cmd.ExitCode(err))
+	}
+	cmd.RootCmd.SetArgs(args)
+	err = cmd.RootCmd.Execute()
+	if err != nil {
+		os.Exit(cmd.ExitCode(err))
 	}
 }
 
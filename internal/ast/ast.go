@@ -1,131 +1,299 @@
 package ast
 
 import (
+	"sort"
+
+	"github.com/jmpargana/gq/internal/gqjson"
 	"github.com/jmpargana/gq/internal/stream"
 	u "github.com/jmpargana/gq/internal/utils"
 )
 
-func TransformStream(s stream.Stream, n u.Node) stream.Stream {
-	prev := s
-
-	if n.Value.Kind == u.PIPE {
-
-		// TODO: test chained pipes vs multiple children
-		left := TransformStream(prev, n.Children[0])
-		rightNode := n.Children[1]
-
-		next := stream.New()
-
-		for _, it := range left.O {
-			out := TransformStream(stream.NewS(it), rightNode)
-			next.O = append(next.O, out.O...)
+// TransformStream runs the program in env on every value of the stream. When
+// an error occurs, the values produced before it are returned alongside the
+// error.
+func TransformStream(env *Env, s stream.Stream, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	for _, o := range s.O {
+		err := each(env, o, n, func(v any) error {
+			next.O = append(next.O, v)
+			return nil
+		})
+		if err != nil {
+			return next, err
 		}
-
-		return next
 	}
+	return next, nil
+}
 
-	// prevent doubled indexing when creating dict
-	if n.Value.Kind == u.ASSIGN {
-		return prev
-	}
+// TransformEach runs the program in env on o, passing every output to emit
+// as soon as it is produced. Generators such as inputs and fromstream then
+// hand their values on one at a time instead of collecting them first.
+func TransformEach(env *Env, o any, n u.Node, emit func(any)) error {
+	return each(env, o, n, func(v any) error {
+		emit(v)
+		return nil
+	})
+}
 
-	for _, c := range n.Children {
-		prev = TransformStream(prev, c)
+// each is transform passing outputs to emit one at a time. Pipes and commas
+// are evaluated by it, so that the outputs of generators flow through them
+// without being collected, while other expressions are left to transform.
+// Evaluation stops at the first error, including one returned by emit.
+func each(env *Env, o any, n u.Node, emit func(any) error) error {
+	switch n.Value.Kind {
+	case u.PIPE:
+		return each(env, o, n.Children[0], func(v any) error {
+			return each(env, v, n.Children[1], emit)
+		})
+	case u.COMMA:
+		if err := each(env, o, n.Children[0], emit); err != nil {
+			return err
+		}
+		return each(env, o, n.Children[1], emit)
+	case u.FUNC:
+		if g, ok := generators[builtinName(n)]; ok {
+			return g(env, o, n.Children, emit)
+		}
+	}
+	out, err := transform(env, o, n)
+	for _, v := range out.O {
+		if err := emit(v); err != nil {
+			return err
+		}
 	}
+	return err
+}
 
+func transform(env *Env, o any, n u.Node) (stream.Stream, error) {
 	switch n.Value.Kind {
+	case u.PIPE:
+		// TODO: test chained pipes vs multiple children
+		left, err := transform(env, o, n.Children[0])
+		next, rerr := TransformStream(env, left, n.Children[1])
+		if rerr != nil {
+			return next, rerr
+		}
+		return next, err
+	case u.COMMA:
+		left, err := transform(env, o, n.Children[0])
+		if err != nil {
+			return left, err
+		}
+		right, err := transform(env, o, n.Children[1])
+		left.O = append(left.O, right.O...)
+		return left, err
 	case u.IDX:
-		prev = indexStream(prev, n.Value)
+		return indexValue(o, n.Value)
 	case u.INDEXSTART:
 		arr := []any{}
-		arr = append(arr, prev.O...)
-		prev = stream.NewS(arr)
+		if len(n.Children) == 0 {
+			return stream.NewS(arr), nil
+		}
+		inner, err := transform(env, o, n.Children[0])
+		if err != nil {
+			return stream.New(), err
+		}
+		arr = append(arr, inner.O...)
+		return stream.NewS(arr), nil
 	case u.DICTSTART:
-		prev = dictStream(prev, n)
+		return dictValue(env, o, n)
+	case u.LITERAL:
+		return stream.NewS(n.Value.Literal), nil
+	case u.BINOP:
+		return binopValue(env, o, n)
+	case u.AND, u.OR:
+		return logicValue(env, o, n)
+	case u.ALT:
+		return alternativeValue(env, o, n)
+	case u.UPDATE:
+		return updateValue(env, o, n)
+	case u.FUNC:
+		return callBuiltin(env, o, n)
+	case u.TRY:
+		return tryValue(env, o, n)
+	case u.FORMAT:
+		return formatValue(env, o, n)
+	case u.AS:
+		return bindValue(env, o, n)
+	case u.LOOKUP:
+		return lookupValue(env, o, n)
+	case u.REDUCE:
+		return reduceValue(env, o, n)
+	case u.VARIABLE:
+		v, ok := env.lookup(n.Value.Ident)
+		if !ok {
+			return stream.New(), errorf("$%s is not defined", n.Value.Ident)
+		}
+		return stream.NewS(v), nil
 	}
-
-	return prev
+	return stream.New(), errorf("unknown expression %s", PrintAST(n, 0))
 }
 
-func indexStream(s stream.Stream, c u.Cmd) stream.Stream {
+func indexValue(o any, c u.Cmd) (stream.Stream, error) {
 	nextS := stream.New()
-	for _, o := range s.O {
-		prevs := []any{o}
-
-		for _, f := range c.Fields {
-			var newPrevs []any
-
-			for _, prev := range prevs {
-				switch f.Kind {
-				case u.IDX:
-					l := prev.([]any)
-					newPrevs = append(newPrevs, l[f.Idx])
-				case u.ROOT:
-					newPrevs = append(newPrevs, prev)
-				case u.FIELD:
-					m := prev.(map[string]any)
-					newPrevs = append(newPrevs, m[f.Name])
-				case u.ARRAY:
-					switch prev := prev.(type) {
-					case []any:
-						l := prev
-						newPrevs = append(newPrevs, l...)
-					case map[string]any:
-						for _, v := range prev {
-							newPrevs = append(newPrevs, v)
-						}
-					}
+	prevs := []any{o}
+
+	for _, f := range c.Fields {
+		var newPrevs []any
+
+		for _, prev := range prevs {
+			switch f.Kind {
+			case u.ROOT:
+				newPrevs = append(newPrevs, prev)
+			case u.ARRAY:
+				vs, err := iterate(prev)
+				if err != nil {
+					return nextS, err
 				}
+				newPrevs = append(newPrevs, vs...)
+			default:
+				v, err := index(prev, f)
+				if err != nil {
+					return nextS, err
+				}
+				newPrevs = append(newPrevs, v)
 			}
+		}
+
+		prevs = newPrevs
+	}
 
-			prevs = newPrevs
+	nextS.O = append(nextS.O, prevs...)
+	return nextS, nil
+}
+
+// index looks up a single field or array position. Missing keys, indices out
+// of range and indexing null all yield null, as in jq.
+func index(o any, f u.IdxField) (any, error) {
+	switch f.Kind {
+	case u.FIELD:
+		switch m := o.(type) {
+		case *gqjson.Object:
+			v, _ := m.Get(f.Name)
+			return v, nil
+		case nil:
+			return nil, nil
+		}
+		return nil, errorf("Cannot index %s with %q", typeName(o), f.Name)
+	case u.IDX:
+		switch l := o.(type) {
+		case []any:
+			i := f.Idx
+			if i < 0 {
+				i += len(l)
+			}
+			if i < 0 || i >= len(l) {
+				return nil, nil
+			}
+			return l[i], nil
+		case nil:
+			return nil, nil
 		}
+		return nil, errorf("Cannot index %s with number", typeName(o))
+	}
+	return o, nil
+}
 
-		nextS.O = append(nextS.O, prevs...)
+// keyField converts the value of a dynamic index such as `.[$k]` to the
+// field it selects. Like jq, fractional indices are truncated.
+func keyField(o, k any) (u.IdxField, error) {
+	switch k := k.(type) {
+	case string:
+		return u.IdxField{Kind: u.FIELD, Name: k}, nil
+	case int64, float64:
+		i, _ := toInt(k)
+		return u.IdxField{Kind: u.IDX, Idx: i}, nil
 	}
-	return nextS
+	return u.IdxField{}, errorf("Cannot index %s with %s", typeName(o), typeName(k))
 }
 
-func cloneMap(m map[string]any) map[string]any {
-	result := make(map[string]any)
-	for k, v := range m {
-		result[k] = v
+// lookupValue evaluates `term[key]`, where both the term and the key are
+// evaluated against the input. The key drives the outer loop.
+func lookupValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	keys, err := transform(env, o, n.Children[1])
+	if err != nil {
+		return next, err
 	}
-	return result
+	terms, err := transform(env, o, n.Children[0])
+	if err != nil {
+		return next, err
+	}
+	for _, k := range keys.O {
+		for _, t := range terms.O {
+			f, err := keyField(t, k)
+			if err != nil {
+				return next, err
+			}
+			v, err := index(t, f)
+			if err != nil {
+				return next, err
+			}
+			next.O = append(next.O, v)
+		}
+	}
+	return next, nil
 }
 
-func dictStream(o stream.Stream, n u.Node) stream.Stream {
-	nextS := stream.New()
-	for _, s := range o.O {
-		// cartesian product
-		partials := []map[string]any{
-			{},
+// iterate returns the values of an array or object, the latter in the order
+// of its keys.
+func iterate(o any) ([]any, error) {
+	switch o := o.(type) {
+	case []any:
+		return o, nil
+	case *gqjson.Object:
+		out := make([]any, 0, o.Len())
+		for _, v := range o.All() {
+			out = append(out, v)
 		}
+		return out, nil
+	}
+	return nil, errorf("Cannot iterate over %s", describe(o))
+}
+
+// sortedKeys returns the keys of an object sorted, the order in which jq
+// compares objects.
+func sortedKeys(o *gqjson.Object) []string {
+	keys := append([]string{}, o.Keys()...)
+	sort.Strings(keys)
+	return keys
+}
 
-		for _, c := range n.Children {
+func cloneList(l []any) []any {
+	result := make([]any, len(l))
+	copy(result, l)
+	return result
+}
 
-			innerS := stream.New()
-			innerS.O = append(innerS.O, s)
+func dictValue(env *Env, s any, n u.Node) (stream.Stream, error) {
+	nextS := stream.New()
+	// cartesian product
+	partials := []*gqjson.Object{
+		gqjson.NewObject(len(n.Children)),
+	}
 
-			innerS = TransformStream(innerS, c.Children[0])
+	for _, c := range n.Children {
+		innerS, err := transform(env, s, c.Children[0])
+		if err != nil {
+			return nextS, err
+		}
 
-			var nextPartials []map[string]any
+		var nextPartials []*gqjson.Object
 
-			for _, p := range partials {
-				for _, in := range innerS.O {
-					np := cloneMap(p)
-					np[c.Value.Ident] = in
-					nextPartials = append(nextPartials, np)
-				}
+		for _, p := range partials {
+			for _, in := range innerS.O {
+				np := p.Clone()
+				np.Set(c.Value.Ident, in)
+				nextPartials = append(nextPartials, np)
 			}
+		}
 
-			partials = nextPartials
+		partials = nextPartials
 
-		}
+	}
 
-		for _, p := range partials {
-			nextS.O = append(nextS.O, p)
-		}
+	for _, p := range partials {
+		nextS.O = append(nextS.O, p)
 	}
-	return nextS
+	return nextS, nil
 }
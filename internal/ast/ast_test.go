@@ -2,11 +2,16 @@ package ast
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
 
 	json "github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/lexer"
+	"github.com/jmpargana/gq/internal/parser"
 	"github.com/jmpargana/gq/internal/stream"
 	u "github.com/jmpargana/gq/internal/utils"
 )
@@ -91,7 +96,7 @@ func TestTranform(t *testing.T) {
 		{
 			desc: "map with new key",
 			a:    "{\"a\": [1, {\"b\": [2, 3]}]}",
-			b:    map[string]interface{}{"b": int64(3)},
+			b:    json.ObjectOf("b", int64(3)),
 			pgr: u.Node{
 				Value: u.Cmd{Kind: u.DICTSTART},
 				Children: []u.Node{{
@@ -129,7 +134,10 @@ func TestTranform(t *testing.T) {
 				t.Fatalf("expected no error, instead got: %v", err)
 			}
 			s := stream.NewS(a)
-			got := TransformStream(s, tC.pgr)
+			got, err := TransformStream(nil, s, tC.pgr)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
 			expected := stream.NewS(tC.b)
 			if !reflect.DeepEqual(expected, got) {
 				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, expected)
@@ -182,7 +190,7 @@ func TestTransformStream(t *testing.T) {
 			// '.[] | {letter: .a}'
 			desc:   "piped dict",
 			start:  `[{"a": "b"}, {"a": "c"}]`,
-			result: stream.Stream{O: []any{map[string]any{"letter": "b"}, map[string]any{"letter": "c"}}},
+			result: stream.Stream{O: []any{json.ObjectOf("letter", "b"), json.ObjectOf("letter", "c")}},
 			program: u.Node{
 				Value: u.Cmd{Kind: u.PIPE},
 				Children: []u.Node{
@@ -209,7 +217,7 @@ func TestTransformStream(t *testing.T) {
 			// '{a: .[]}'
 			desc:   "streamed dict",
 			start:  `[[1], [2]]`,
-			result: stream.Stream{O: []any{map[string]any{"a": []interface{}{int64(1)}}, map[string]any{"a": []interface{}{int64(2)}}}},
+			result: stream.Stream{O: []any{json.ObjectOf("a", []interface{}{int64(1)}), json.ObjectOf("a", []interface{}{int64(2)})}},
 			program: u.Node{
 				Value: u.Cmd{Kind: u.DICTSTART},
 				Children: []u.Node{
@@ -227,7 +235,7 @@ func TestTransformStream(t *testing.T) {
 			// '.[] | {a: .[]}'
 			desc:   "streamed dict",
 			start:  `[[1], [2]]`,
-			result: stream.Stream{O: []any{map[string]any{"a": int64(1)}, map[string]any{"a": int64(2)}}},
+			result: stream.Stream{O: []any{json.ObjectOf("a", int64(1)), json.ObjectOf("a", int64(2))}},
 			program: u.Node{
 				Value: u.Cmd{Kind: u.PIPE},
 				Children: []u.Node{
@@ -282,8 +290,8 @@ func TestTransformStream(t *testing.T) {
 			desc:  "streamed dict",
 			start: `[[1], [2]]`,
 			result: stream.Stream{O: []any{
-				map[string]any{"a": int64(1), "b": int64(1)},
-				map[string]any{"a": int64(2), "b": int64(2)},
+				json.ObjectOf("a", int64(1), "b", int64(1)),
+				json.ObjectOf("a", int64(2), "b", int64(2)),
 			}},
 			program: u.Node{
 				Value: u.Cmd{Kind: u.PIPE},
@@ -314,10 +322,10 @@ func TestTransformStream(t *testing.T) {
 			desc:  "streamed dict",
 			start: `[[1], [2]]`,
 			result: stream.Stream{O: []any{
-				map[string]any{"a": []interface{}{int64(1)}, "b": []interface{}{int64(1)}},
-				map[string]any{"a": []interface{}{int64(1)}, "b": []interface{}{int64(2)}},
-				map[string]any{"a": []interface{}{int64(2)}, "b": []interface{}{int64(1)}},
-				map[string]any{"a": []interface{}{int64(2)}, "b": []interface{}{int64(2)}},
+				json.ObjectOf("a", []interface{}{int64(1)}, "b", []interface{}{int64(1)}),
+				json.ObjectOf("a", []interface{}{int64(1)}, "b", []interface{}{int64(2)}),
+				json.ObjectOf("a", []interface{}{int64(2)}, "b", []interface{}{int64(1)}),
+				json.ObjectOf("a", []interface{}{int64(2)}, "b", []interface{}{int64(2)}),
 			}},
 			program: u.Node{
 				Value: u.Cmd{Kind: u.DICTSTART},
@@ -345,10 +353,1132 @@ func TestTransformStream(t *testing.T) {
 				t.Fatalf("expected no error, instead got: %v", err)
 			}
 			s := stream.NewS(a)
-			got := TransformStream(s, tC.program)
+			got, err := TransformStream(nil, s, tC.program)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
 			if !reflect.DeepEqual(tC.result, got) {
 				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
 			}
 		})
 	}
 }
+
+func run(t *testing.T, program, input string) (stream.Stream, error) {
+	t.Helper()
+	n, err := parser.NewParser(lexer.Lex(program)).Parse()
+	if err != nil {
+		t.Fatalf("failed parsing %s: %v", program, err)
+	}
+	env, err := Bind(n, nil)
+	if err != nil {
+		return stream.New(), err
+	}
+	a, err := json.ParseObject(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	return TransformStream(env, stream.NewS(a), n)
+}
+
+func TestUpdate(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "set nested field",
+			program: `.spec.replicas = 3`,
+			input:   `{"spec": {"replicas": 1, "name": "a"}}`,
+			result:  []any{json.ObjectOf("spec", json.ObjectOf("replicas", int64(3), "name", "a"))},
+		},
+		{
+			desc:    "set creates missing containers",
+			program: `.a.b[1] = true`,
+			input:   `{}`,
+			result:  []any{json.ObjectOf("a", json.ObjectOf("b", []any{nil, true}))},
+		},
+		{
+			desc:    "set with multiple right hand outputs",
+			program: `.a = (1, 2)`,
+			input:   `{"a": 0}`,
+			result:  []any{json.ObjectOf("a", int64(1)), json.ObjectOf("a", int64(2))},
+		},
+		{
+			desc:    "set evaluates right hand side on input",
+			program: `.a = .b`,
+			input:   `{"a": 0, "b": 5}`,
+			result:  []any{json.ObjectOf("a", int64(5), "b", int64(5))},
+		},
+		{
+			desc:    "update iterator with del",
+			program: `.items[] |= del(.status)`,
+			input:   `{"items": [{"a": 1, "status": "x"}, {"status": "y"}]}`,
+			result:  []any{json.ObjectOf("items", []any{json.ObjectOf("a", int64(1)), json.ObjectOf()})},
+		},
+		{
+			desc:    "update with empty deletes",
+			program: `(.[] | select(. > 1)) |= empty`,
+			input:   `[1, 2, 3, 1]`,
+			result:  []any{[]any{int64(1), int64(1)}},
+		},
+		{
+			desc:    "update uses first output",
+			program: `.a |= (1, 2)`,
+			input:   `{"a": 0}`,
+			result:  []any{json.ObjectOf("a", int64(1))},
+		},
+		{
+			desc:    "arithmetic updates",
+			program: `.a += 1 | .b -= 1 | .c *= 2 | .d /= 2 | .e %= 3`,
+			input:   `{"a": 1, "b": 1, "c": 2, "d": 3, "e": 7}`,
+			result:  []any{json.ObjectOf("a", int64(2), "b", int64(0), "c", int64(4), "d", 1.5, "e", int64(1))},
+		},
+		{
+			desc:    "arithmetic update right hand side sees input",
+			program: `.[] += .[0]`,
+			input:   `[1, 2]`,
+			result:  []any{[]any{int64(2), int64(3)}},
+		},
+		{
+			desc:    "alternative update",
+			program: `.a //= 1 | .b //= 1 | .c //= 1`,
+			input:   `{"a": null, "b": false, "c": 2}`,
+			result:  []any{json.ObjectOf("a", int64(1), "b", int64(1), "c", int64(2))},
+		},
+		{
+			desc:    "string concatenation update",
+			program: `.name += "-suffix"`,
+			input:   `{"name": "app"}`,
+			result:  []any{json.ObjectOf("name", "app-suffix")},
+		},
+		{
+			desc:    "recursive update",
+			program: `(.. | select(. == 1)) |= 10`,
+			input:   `{"a": 1, "b": [1, {"c": 1}]}`,
+			result:  []any{json.ObjectOf("a", int64(10), "b", []any{int64(10), json.ObjectOf("c", int64(10))})},
+		},
+		{
+			desc:    "del multiple indices",
+			program: `del(.[0], .[2])`,
+			input:   `[1, 2, 3]`,
+			result:  []any{[]any{int64(2)}},
+		},
+		{
+			desc:    "paths",
+			program: `[paths], [path(.a[0])]`,
+			input:   `{"a": [1]}`,
+			result:  []any{[]any{[]any{"a"}, []any{"a", int64(0)}}, []any{[]any{"a", int64(0)}}},
+		},
+		{
+			desc:    "getpath setpath delpaths",
+			program: `getpath(["a", "b"]), setpath(["a", "c"]; 2), delpaths([["a"]])`,
+			input:   `{"a": {"b": 1}}`,
+			result:  []any{int64(1), json.ObjectOf("a", json.ObjectOf("b", int64(1), "c", int64(2))), json.ObjectOf()},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestUpdateDoesNotMutateInput(t *testing.T) {
+	n, err := parser.NewParser(lexer.Lex(`.a.b = 2, .l[0] |= . + 1, del(.a.b), .`)).Parse()
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	input := json.ObjectOf(
+		"a", json.ObjectOf("b", int64(1)),
+		"l", []any{int64(1)},
+	)
+	got, err := TransformStream(nil, stream.NewS(input), n)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	original := json.ObjectOf(
+		"a", json.ObjectOf("b", int64(1)),
+		"l", []any{int64(1)},
+	)
+	if !reflect.DeepEqual(input, original) || !reflect.DeepEqual(got.O[3], original) {
+		t.Fatalf("input was mutated: %v", input)
+	}
+}
+
+func TestOperators(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "integer arithmetic stays exact",
+			program: `.a + 1, .a - 1, .a * 2, .a / 2, .a / 3, .a % 3`,
+			input:   `{"a": 9}`,
+			result:  []any{int64(10), int64(8), int64(18), 4.5, int64(3), int64(0)},
+		},
+		{
+			desc:    "cartesian product",
+			program: `[(1, 2) + (10, 20)]`,
+			input:   `{}`,
+			result:  []any{[]any{int64(11), int64(12), int64(21), int64(22)}},
+		},
+		{
+			desc:    "integer overflow falls back to floats",
+			program: `.m * -1, -1 * .m, .m / -1, -.m`,
+			input:   `{"m": -9223372036854775808}`,
+			result:  []any{9223372036854775808.0, 9223372036854775808.0, 9223372036854775808.0, 9223372036854775808.0},
+		},
+		{
+			desc:    "null is the identity of addition",
+			program: `null + 1, [1] + null`,
+			input:   `{}`,
+			result:  []any{int64(1), []any{int64(1)}},
+		},
+		{
+			desc:    "array and object operators",
+			program: `[1, 2, 1] - [1], {"a": {"b": 1}} * {"a": {"c": 2}}, "a,b" / ","`,
+			input:   `{}`,
+			result: []any{
+				[]any{int64(2)},
+				json.ObjectOf("a", json.ObjectOf("b", int64(1), "c", int64(2))),
+				[]any{"a", "b"},
+			},
+		},
+		{
+			desc:    "comparisons",
+			program: `1 < 2, "a" > "b", [1] == [1], null < false, 1 == 1.0`,
+			input:   `{}`,
+			result:  []any{true, false, true, true, true},
+		},
+		{
+			desc:    "logic and alternative",
+			program: `(true and false), (null or 1), (.a // "d"), (empty // 2), (.b.c // 3)`,
+			input:   `{"a": false, "b": 1}`,
+			result:  []any{false, true, "d", int64(2), int64(3)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "catch receives error message",
+			program: `[.a[] | try (. + 1) catch .]`,
+			input:   `{"a": [1, "x"]}`,
+			result:  []any{[]any{int64(2), `string ("x") and number (1) cannot be added`}},
+		},
+		{
+			desc:    "catch receives original error value",
+			program: `try error({"code": 42}) catch .code`,
+			input:   `{}`,
+			result:  []any{int64(42)},
+		},
+		{
+			desc:    "error without argument raises input",
+			program: `try error catch .`,
+			input:   `{"a": 1}`,
+			result:  []any{json.ObjectOf("a", int64(1))},
+		},
+		{
+			desc:    "try without catch suppresses error",
+			program: `[.[] | try error("x")], "after"`,
+			input:   `[1, 2]`,
+			result:  []any{[]any{}, "after"},
+		},
+		{
+			desc:    "outputs before the error are kept",
+			program: `[(1, error("x"), 3)?]`,
+			input:   `{}`,
+			result:  []any{[]any{int64(1)}},
+		},
+		{
+			desc:    "optional index",
+			program: `[.a[]?], .a?.b?, [.b[]?]`,
+			input:   `{"a": 1, "b": [2]}`,
+			result:  []any{[]any{}, []any{int64(2)}},
+		},
+		{
+			desc:    "optional path expression",
+			program: `.a[]? |= . + 1`,
+			input:   `{"a": [1, 2]}`,
+			result:  []any{json.ObjectOf("a", []any{int64(2), int64(3)})},
+		},
+		{
+			desc:    "errors in handler propagate to outer try",
+			program: `try (try error("inner") catch error("outer: " + .)) catch .`,
+			input:   `{}`,
+			result:  []any{"outer: inner"},
+		},
+		{
+			desc:    "alternative suppresses errors",
+			program: `error("x") // 1`,
+			input:   `{}`,
+			result:  []any{int64(1)},
+		},
+		{
+			desc:    "location of the program",
+			program: "1,\n$__loc__",
+			input:   `{}`,
+			result:  []any{int64(1), json.ObjectOf("file", "<top-level>", "line", int64(2))},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestErrorValue(t *testing.T) {
+	got, err := run(t, `1, error({"a": 1}), 2`, `{}`)
+	if !reflect.DeepEqual(stream.Stream{O: []any{int64(1)}}, got) {
+		t.Fatalf("expected outputs before error, got: %v", got)
+	}
+	var ve *ValueError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected value error, got: %v", err)
+	}
+	if !reflect.DeepEqual(ve.Value, json.ObjectOf("a", int64(1))) {
+		t.Fatalf("unexpected error value: %v", ve.Value)
+	}
+	if ve.Error() != `{"a":1} (not a string)` {
+		t.Fatalf("unexpected error message: %s", ve.Error())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "interpolation",
+			program: `"Hello \(.name)! \(.a)"`,
+			input:   `{"name": "Bob", "a": [1, {"b": null}]}`,
+			result:  []any{`Hello Bob! [1,{"b":null}]`},
+		},
+		{
+			desc:    "later parts vary slowest",
+			program: `"\(1, 2) \(3, 4)"`,
+			input:   `{}`,
+			result:  []any{"1 3", "2 3", "1 4", "2 4"},
+		},
+		{
+			desc:    "nested interpolation",
+			program: `"a\("b\(.x)")"`,
+			input:   `{"x": "c"}`,
+			result:  []any{"abc"},
+		},
+		{
+			desc:    "format applies to interpolated values only",
+			program: `{a: "<'&\"> é"} | @html "<b>\(.a)</b>", @uri "?q=\(.a)", @base64 "\("x")"`,
+			input:   `{}`,
+			result:  []any{"<b>&lt;&#39;&amp;&quot;&gt; é</b>", "?q=%3C%27%26%22%3E%20%C3%A9", "eA=="},
+		},
+		{
+			desc:    "csv and tsv",
+			program: `[1, "a\"b", null, true, "x\ty"] | @csv, @tsv`,
+			input:   `{}`,
+			result:  []any{`1,"a""b",,true,"x	y"`, `1	a"b		true	x\ty`},
+		},
+		{
+			desc:    "sh",
+			program: `@sh "echo \(.a)", ([1, "it's"] | @sh)`,
+			input:   `{"a": "$HOME"}`,
+			result:  []any{`echo '$HOME'`, `1 'it'\''s'`},
+		},
+		{
+			desc:    "json and text",
+			program: `.a | @json, @text, ("x" | @json)`,
+			input:   `{"a": [1, "b"]}`,
+			result:  []any{`[1,"b"]`, `[1,"b"]`, `"x"`},
+		},
+		{
+			desc:    "base64 round trip",
+			program: `@base64, (@base64 | @base64d)`,
+			input:   `{"a": 1}`,
+			result:  []any{"eyJhIjoxfQ==", `{"a":1}`},
+		},
+		{
+			desc:    "format builtin",
+			program: `.a | format("csv")`,
+			input:   `{"a": [1, "x"]}`,
+			result:  []any{`1,"x"`},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestRegex(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "test with flags",
+			program: `.s | test("B"), test("B"; "i"), test(["b", "i"]), test("a b c # letters"; "x")`,
+			input:   `{"s": "abc"}`,
+			result:  []any{false, true, true, true},
+		},
+		{
+			desc:    "match offsets are codepoints",
+			program: `.s | match("(?<x>é)(z)?")`,
+			input:   `{"s": "aé"}`,
+			result: []any{json.ObjectOf(
+				"offset", int64(1),
+				"length", int64(1),
+				"string", "é",
+				"captures", []any{
+					json.ObjectOf("offset", int64(1), "length", int64(1), "string", "é", "name", "x"),
+					json.ObjectOf("offset", int64(-1), "length", int64(0), "string", nil, "name", nil),
+				},
+			)},
+		},
+		{
+			desc:    "global match",
+			program: `[.s | match("a"; "g").offset], [.s | match(""; "gn")]`,
+			input:   `{"s": "aba"}`,
+			result:  []any{[]any{int64(0), int64(2)}, []any{}},
+		},
+		{
+			desc:    "capture",
+			program: `.s | capture("(?<key>\\w+)=(?<value>\\w+)"; "g")`,
+			input:   `{"s": "a=1 b=2"}`,
+			result:  []any{json.ObjectOf("key", "a", "value", "1"), json.ObjectOf("key", "b", "value", "2")},
+		},
+		{
+			desc:    "scan",
+			program: `[.s | scan("[0-9]+")], [.s | scan("(.)=(.)")]`,
+			input:   `{"s": "a=1 b=22"}`,
+			result:  []any{[]any{"1", "22"}, []any{[]any{"a", "1"}, []any{"b", "2"}}},
+		},
+		{
+			desc:    "split and splits",
+			program: `(.s | split(", *"; null)), [.s | splits("B"; "i")]`,
+			input:   `{"s": "a, b,c"}`,
+			result:  []any{[]any{"a", "b", "c"}, []any{"a, ", ",c"}},
+		},
+		{
+			desc:    "sub and gsub",
+			program: `.s | sub("(?<x>[a-z]+)"; "<\(.x)>"), gsub("[aeiou]"; "_"), gsub("(?<d>\\d)"; "\(.d)\(.d)")`,
+			input:   `{"s": "abc-12"}`,
+			result:  []any{"<abc>-12", "_bc-12", "abc-1122"},
+		},
+		{
+			desc:    "sub with multiple replacements",
+			program: `.s | sub("b"; "1", "2")`,
+			input:   `{"s": "abc"}`,
+			result:  []any{"a1c", "a2c"},
+		},
+		{
+			desc:    "dot matches newline with s",
+			program: `"a\nb" | test("a.b"), test("a.b"; "s")`,
+			input:   `{}`,
+			result:  []any{false, true},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestRegexCacheBounded(t *testing.T) {
+	c := newRegexLRU(2)
+	for _, key := range []string{"a", "b", "a", "c"} {
+		c.put(key, &regex{})
+	}
+	if _, ok := c.get("b"); ok {
+		t.Fatalf("expected the least recently used expression to be dropped")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("expected %q to stay cached", key)
+		}
+	}
+	if c.order.Len() != 2 || len(c.entries) != 2 {
+		t.Fatalf("expected 2 cached expressions, instead got %d", c.order.Len())
+	}
+}
+
+func TestStrings(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "case only changes ascii letters",
+			program: `.s | ascii_downcase, ascii_upcase`,
+			input:   `{"s": "ÉcoLE"}`,
+			result:  []any{"École", "ÉCOLE"},
+		},
+		{
+			desc:    "length counts codepoints",
+			program: `(.s | length, utf8bytelength), (.a | length), (null | length), (-5 | length), (.m | length)`,
+			input:   `{"s": "aé😀", "a": [1, 2], "m": -9223372036854775808}`,
+			result:  []any{int64(3), int64(7), int64(2), int64(0), int64(5), 9223372036854775808.0},
+		},
+		{
+			desc:    "trimming affixes",
+			program: `.s | ltrimstr("ab"), rtrimstr("ab"), trimstr("ab"), ltrimstr(1), (1 | ltrimstr("a"))`,
+			input:   `{"s": "abcab"}`,
+			result:  []any{"cab", "abc", "c", "abcab", int64(1)},
+		},
+		{
+			desc:    "trimming whitespace",
+			program: `" a b\t\n" | trim, ltrim, rtrim`,
+			input:   `{}`,
+			result:  []any{"a b", "a b\t\n", " a b"},
+		},
+		{
+			desc:    "prefixes and suffixes",
+			program: `.s | startswith("ab"), startswith("b"), endswith("cd")`,
+			input:   `{"s": "abcd"}`,
+			result:  []any{true, false, true},
+		},
+		{
+			desc:    "split and join",
+			program: `(.s | split(", ")), (.s | split(", ") | join("|")), ([1, null, "a", true] | join("-"))`,
+			input:   `{"s": "a, b, c"}`,
+			result:  []any{[]any{"a", "b", "c"}, "a|b|c", "1--a-true"},
+		},
+		{
+			desc:    "explode and implode",
+			program: `.s | explode, (explode | implode), (65 | ascii)`,
+			input:   `{"s": "aé😀"}`,
+			result:  []any{[]any{int64(97), int64(233), int64(128512)}, "aé😀", "A"},
+		},
+		{
+			desc:    "tojson and tostring",
+			program: `.a | tojson, tostring, (.[1] | tojson, tostring)`,
+			input:   `{"a": [1, "b"]}`,
+			result:  []any{`[1,"b"]`, `[1,"b"]`, `"b"`, "b"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestDates(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "broken down time",
+			program: `.t | gmtime, (gmtime | mktime)`,
+			input:   `{"t": 1425599621}`,
+			result: []any{
+				[]any{int64(2015), int64(2), int64(5), int64(23), int64(53), int64(41), int64(4), int64(63)},
+				int64(1425599621),
+			},
+		},
+		{
+			desc:    "iso 8601",
+			program: `.t | todate, todateiso8601, date, (todate | fromdate), (todate | fromdateiso8601)`,
+			input:   `{"t": 1425599621}`,
+			result:  []any{"2015-03-05T23:53:41Z", "2015-03-05T23:53:41Z", "2015-03-05T23:53:41Z", int64(1425599621), int64(1425599621)},
+		},
+		{
+			desc:    "strftime",
+			program: `.t | strftime("%A, %B %e %Y %I:%M %p"), (gmtime | strftime("%j %u %Z %s %%"))`,
+			input:   `{"t": 1425599621}`,
+			result:  []any{"Thursday, March  5 2015 11:53 PM", "064 4 UTC 1425599621 %"},
+		},
+		{
+			desc:    "strptime",
+			program: `.s | strptime("%d %b %Y %H:%M:%S %z"), (strptime("%d %b %Y %H:%M:%S %z") | mktime)`,
+			input:   `{"s": "10 mar 2024  14:05:09 +0100"}`,
+			result: []any{
+				[]any{int64(2024), int64(2), int64(10), int64(14), int64(5), int64(9), int64(0), int64(69)},
+				int64(1710079509),
+			},
+		},
+		{
+			desc:    "mktime normalises out of range fields",
+			program: `.d | mktime | todate`,
+			input:   `{"d": [2024, 1, 30, 0, 0, 0]}`,
+			result:  []any{"2024-03-01T00:00:00Z"},
+		},
+		{
+			desc:    "dateadd and datesub",
+			program: `.t | dateadd("seconds"; 10), datesub("seconds"; 21)`,
+			input:   `{"t": 1425599621}`,
+			result:  []any{int64(1425599631), int64(1425599600)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestMath(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "out of range literals are infinite or zero",
+			program: `1e1000 | isinfinite, (-1e1000 | . < 0), 1e-1000 == 0`,
+			input:   `{}`,
+			result:  []any{true, true, true},
+		},
+		{
+			desc:    "rounding keeps integers exact",
+			program: `.a, .b | floor, ceil, round, trunc`,
+			input:   `{"a": 9007199254740993, "b": -2.5}`,
+			result: []any{
+				int64(9007199254740993), int64(9007199254740993), int64(9007199254740993), int64(9007199254740993),
+				int64(-3), int64(-2), int64(-3), int64(-2),
+			},
+		},
+		{
+			desc:    "absolute values",
+			program: `.a, .b, .m | abs, fabs`,
+			input:   `{"a": -7, "b": -2.5, "m": -9223372036854775808}`,
+			result:  []any{int64(7), float64(7), 2.5, 2.5, 9223372036854775808.0, 9223372036854775808.0},
+		},
+		{
+			desc:    "functions",
+			program: `(16 | sqrt), pow(2; 10), (8 | log2), (1000 | log10), (0 | exp), (1 | log), (12 | significand)`,
+			input:   `{}`,
+			result:  []any{float64(4), float64(1024), float64(3), float64(3), float64(1), float64(0), 1.5},
+		},
+		{
+			desc:    "infinities and nan",
+			program: `(infinite, -infinite, nan, 1) | [isinfinite, isnan, isnormal]`,
+			input:   `{}`,
+			result:  []any{[]any{true, false, false}, []any{true, false, false}, []any{false, true, false}, []any{false, false, true}},
+		},
+		{
+			desc:    "nan sorts below numbers",
+			program: `nan < 0, nan == nan, ([nan] | tostring)`,
+			input:   `{}`,
+			result:  []any{true, false, "[null]"},
+		},
+		{
+			desc:    "floats as strings",
+			program: `.[] | tostring, @text "\(.)"`,
+			input:   `[1.5, 3.0, 1e100]`,
+			result:  []any{"1.5", "1.5", "3", "3", "1e+100", "1e+100"},
+		},
+		{
+			desc:    "tonumber",
+			program: `.[] | tonumber`,
+			input:   `["12", "-1.5", "1e3", 7]`,
+			result:  []any{int64(12), -1.5, float64(1000), int64(7)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "binding keeps the input",
+			program: `.a as $x | .b + $x`,
+			input:   `{"a": 1, "b": 2}`,
+			result:  []any{int64(3)},
+		},
+		{
+			desc:    "one body per value",
+			program: `.a[] as $x | .a[] as $y | [$x, $y]`,
+			input:   `{"a": [1, 2]}`,
+			result:  []any{[]any{int64(1), int64(1)}, []any{int64(1), int64(2)}, []any{int64(2), int64(1)}, []any{int64(2), int64(2)}},
+		},
+		{
+			desc:    "inner binding shadows outer",
+			program: `1 as $x | (2 as $x | $x), $x`,
+			input:   `{}`,
+			result:  []any{int64(2), int64(1)},
+		},
+		{
+			desc:    "binding shadows predefined variables",
+			program: `1 as $ARGS | $ARGS`,
+			input:   `{}`,
+			result:  []any{int64(1)},
+		},
+		{
+			desc:    "binds tighter than comma",
+			program: `.a as $x | $x, $x * 2`,
+			input:   `{"a": 2}`,
+			result:  []any{int64(2), int64(4)},
+		},
+		{
+			desc:    "dynamic index",
+			program: `.k as $k | .m[$k], .m[.k], .l[.i]`,
+			input:   `{"k": "b", "m": {"b": 1}, "l": [5, 6], "i": 1}`,
+			result:  []any{int64(1), int64(1), int64(6)},
+		},
+		{
+			desc:    "update through dynamic index",
+			program: `.k as $k | .m[$k] |= . + 1`,
+			input:   `{"k": "b", "m": {"b": 1}}`,
+			result:  []any{json.ObjectOf("k", "b", "m", json.ObjectOf("b", int64(2)))},
+		},
+		{
+			desc:    "variable in object shorthand",
+			program: `.a as $a | {$a, b: $a}`,
+			input:   `{"a": 1}`,
+			result:  []any{json.ObjectOf("a", int64(1), "b", int64(1))},
+		},
+		{
+			desc:    "reduce",
+			program: `reduce .a[] as $x (0; . + $x), reduce .a[] as $x ([]; [$x] + .)`,
+			input:   `{"a": [1, 2, 3]}`,
+			result:  []any{int64(6), []any{int64(3), int64(2), int64(1)}},
+		},
+		{
+			desc:    "reduce keeps the last update",
+			program: `reduce .a[] as $x (0; ., $x), reduce .a[] as $x (0; empty), reduce empty as $x (0, 1; 2)`,
+			input:   `{"a": [1, 2]}`,
+			result:  []any{int64(2), nil, int64(0), int64(1)},
+		},
+		{
+			desc:    "predefined variables",
+			program: `$ARGS, $ENV.PATH == env.PATH`,
+			input:   `{}`,
+			result:  []any{json.ObjectOf("positional", []any{}, "named", json.ObjectOf()), true},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+type sliceInputs []any
+
+func (s *sliceInputs) Next() (any, error) {
+	if len(*s) == 0 {
+		return nil, io.EOF
+	}
+	v := (*s)[0]
+	*s = (*s)[1:]
+	return v, nil
+}
+
+func (s *sliceInputs) Filename() any { return "data.json" }
+
+func (s *sliceInputs) LineNumber() int64 { return int64(3 - len(*s)) }
+
+func TestInputs(t *testing.T) {
+	n, err := parser.NewParser(lexer.Lex(`[input, input_line_number, input_filename], [inputs], try input catch .`)).Parse()
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	env, err := Bind(n, nil)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	env = env.WithInputs(&sliceInputs{int64(1), int64(2), int64(3)})
+	got, err := TransformStream(env, stream.NewS(nil), n)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	want := stream.Stream{O: []any{[]any{int64(1), int64(1), "data.json"}, []any{int64(2), int64(3)}, "No more inputs"}}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, want)
+	}
+}
+
+func TestTransformEachIsLazy(t *testing.T) {
+	n, err := parser.NewParser(lexer.Lex(`fromstream(1 | truncate_stream(inputs))`)).Parse()
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	// the events of [[1], [2]]
+	in := &sliceInputs{
+		[]any{[]any{int64(0), int64(0)}, int64(1)},
+		[]any{[]any{int64(0), int64(0)}},
+		[]any{[]any{int64(1), int64(0)}, int64(2)},
+		[]any{[]any{int64(1), int64(0)}},
+		[]any{[]any{int64(1)}},
+	}
+	// every value is emitted before the events of the next one are read
+	var got, left []any
+	err = TransformEach((*Env)(nil).WithInputs(in), nil, n, func(v any) {
+		got = append(got, v)
+		left = append(left, int64(len(*in)))
+	})
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if want := []any{[]any{int64(1)}, []any{int64(2)}}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, want)
+	}
+	if want := []any{int64(3), int64(1)}; !reflect.DeepEqual(want, left) {
+		t.Fatalf("expected inputs left after every value to be %v, instead got %v", want, left)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	testCases := []struct {
+		desc, program, input string
+		result               []any
+	}{
+		{
+			desc:    "tostream",
+			program: `tostream`,
+			input:   `{"a": [1, {}], "b": 2}`,
+			result: []any{
+				[]any{[]any{"a", int64(0)}, int64(1)},
+				[]any{[]any{"a", int64(1)}, json.ObjectOf()},
+				[]any{[]any{"a", int64(1)}},
+				[]any{[]any{"b"}, int64(2)},
+				[]any{[]any{"b"}},
+			},
+		},
+		{
+			desc:    "tostream of a scalar",
+			program: `.[0] | tostream`,
+			input:   `[3]`,
+			result:  []any{[]any{[]any{}, int64(3)}},
+		},
+		{
+			desc:    "fromstream round trip",
+			program: `fromstream(tostream)`,
+			input:   `{"a": [1, {"b": null}], "c": []}`,
+			result:  []any{json.ObjectOf("a", []any{int64(1), json.ObjectOf("b", nil)}, "c", []any{})},
+		},
+		{
+			desc:    "fromstream of several values",
+			program: `fromstream(([1, 2], 3, {"a": 4}) | tostream)`,
+			input:   `{}`,
+			result:  []any{[]any{int64(1), int64(2)}, int64(3), json.ObjectOf("a", int64(4))},
+		},
+		{
+			desc:    "truncate_stream with input depth",
+			program: `[1 | truncate_stream([[0], 1], [[1, 0], 2], [[1, 0]], [[1]])]`,
+			input:   `{}`,
+			result:  []any{[]any{[]any{[]any{int64(0)}, int64(2)}, []any{[]any{int64(0)}}}},
+		},
+		{
+			desc:    "elements of a top-level array",
+			program: `fromstream(truncate_stream(1; tostream))`,
+			input:   `[{"a": 1}, [2]]`,
+			result:  []any{json.ObjectOf("a", int64(1)), []any{int64(2)}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestProjection(t *testing.T) {
+	input := `{"a": {"b": [1, {"c": "x"}, [2]], "d": null}, "e": [{"f": 1, "g": 2}, {"f": 3}], "h": "s"}`
+	testCases := []struct {
+		program string
+		full    bool
+	}{
+		{program: `.a.b[1].c`},
+		{program: `.e[] | .f`},
+		{program: `.e[-1]`},
+		{program: `.a.b[0] + 1, .h`},
+		{program: `.e[] | select(.f > 1) | .g`},
+		{program: `{x: .a.d, y: [.e[0].g]}`},
+		{program: `.h as $h | .a.b[2] | [$h, .[0]]`},
+		{program: `.a["b"][0]`},
+		{program: `try .h[] catch .`},
+		{program: `.e | length`},
+		{program: `reduce .e[] as $x (0; . + $x.f)`},
+		{program: `1, empty`},
+		{program: `.a | keys`},
+		{program: `keys`, full: true},
+		{program: `..`, full: true},
+		{program: `.e |= 1`, full: true},
+		{program: `., input`, full: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.program, func(t *testing.T) {
+			n, err := parser.NewParser(lexer.Lex(tC.program)).Parse()
+			if err != nil {
+				t.Fatalf("failed parsing %s: %v", tC.program, err)
+			}
+			p := Projection(n)
+			if full := p == nil; full != tC.full {
+				t.Fatalf("expected full decode %v, got %v", tC.full, full)
+			}
+			projected, err := json.ParseProjectedValue(bufio.NewReader(strings.NewReader(input)), p)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			want, werr := run(t, tC.program, input)
+			got, err := TransformStream(nil, stream.NewS(projected), n)
+			if !reflect.DeepEqual(want, got) || fmt.Sprint(werr) != fmt.Sprint(err) {
+				t.Fatalf("not equal:\ngot: %v %v\nwanted: %v %v", got, err, want, werr)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	n, err := parser.NewParser(lexer.Lex(`[$name, $ENV.GQ_TEST]`)).Parse()
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	t.Setenv("GQ_TEST", "env")
+	env, err := Bind(n, map[string]any{"name": "value"})
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	got, err := TransformStream(env, stream.NewS(nil), n)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	want := stream.Stream{O: []any{[]any{"value", "env"}}}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, want)
+	}
+}
+
+func TestHalt(t *testing.T) {
+	testCases := []struct {
+		desc, program string
+		result        []any
+		halt          Halt
+	}{
+		{
+			desc:    "halt keeps earlier outputs",
+			program: `1, halt, 2`,
+			result:  []any{int64(1)},
+			halt:    Halt{},
+		},
+		{
+			desc:    "cannot be caught",
+			program: `try ("x" | halt_error(3)) catch 1`,
+			result:  []any{},
+			halt:    Halt{Code: 3, Value: "x", HasValue: true},
+		},
+		{
+			desc:    "not suppressed by alternative",
+			program: `({} | halt_error) // 1`,
+			result:  []any{},
+			halt:    Halt{Code: 5, Value: json.ObjectOf(), HasValue: true},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := run(t, tC.program, `{}`)
+			var halt *Halt
+			if !errors.As(err, &halt) {
+				t.Fatalf("expected halt, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(tC.halt, *halt) {
+				t.Fatalf("not equal:\ngot: %+v\nwanted: %+v", *halt, tC.halt)
+			}
+			if !reflect.DeepEqual(stream.Stream{O: tC.result}, got) {
+				t.Fatalf("not equal:\ngot: %v\nwanted: %v", got, tC.result)
+			}
+		})
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	testCases := []struct {
+		desc, program, input, err string
+	}{
+		{
+			desc:    "undefined variable",
+			program: `. as $x | $y`,
+			input:   `{}`,
+			err:     "$y is not defined",
+		},
+		{
+			desc:    "index with object",
+			program: `.[{}]`,
+			input:   `{}`,
+			err:     "Cannot index object with object",
+		},
+		{
+			desc:    "invalid arithmetic",
+			program: `.a -= 1`,
+			input:   `{"a": "x"}`,
+			err:     `string ("x") and number (1) cannot be subtracted`,
+		},
+		{
+			desc:    "division by zero",
+			program: `1 / 0`,
+			input:   `{}`,
+			err:     "divisor is zero",
+		},
+		{
+			desc:    "invalid path",
+			program: `(.a | 1) = 2`,
+			input:   `{}`,
+			err:     "Invalid path expression with result 1",
+		},
+		{
+			desc:    "index of wrong type",
+			program: `.a.b = 1`,
+			input:   `{"a": [1]}`,
+			err:     `Cannot index array with "b"`,
+		},
+		{
+			desc:    "undefined function",
+			program: `nope(1)`,
+			input:   `{}`,
+			err:     "nope/1 is not defined",
+		},
+		{
+			desc:    "regex on non string",
+			program: `.a | test("x")`,
+			input:   `{"a": 1}`,
+			err:     "number (1) cannot be matched, as it is not a string",
+		},
+		{
+			desc:    "invalid regex",
+			program: `.a | test("(")`,
+			input:   `{"a": "x"}`,
+			err:     "( is not a valid regex",
+		},
+		{
+			desc:    "invalid regex flags",
+			program: `.a | test("x"; "q")`,
+			input:   `{"a": "x"}`,
+			err:     "q is not a valid modifier string",
+		},
+		{
+			desc:    "string builtin on number",
+			program: `.a | ascii_downcase`,
+			input:   `{"a": 1}`,
+			err:     "ascii_downcase input must be a string",
+		},
+		{
+			desc:    "join with nested array",
+			program: `.a | join(",")`,
+			input:   `{"a": [[1]]}`,
+			err:     `string ("") and array ([1]) cannot be added`,
+		},
+		{
+			desc:    "length of boolean",
+			program: `true | length`,
+			input:   `{}`,
+			err:     "boolean (true) has no length",
+		},
+		{
+			desc:    "date not matching format",
+			program: `.a | fromdate`,
+			input:   `{"a": "2015-03-05"}`,
+			err:     `date "2015-03-05" does not match format "%Y-%m-%dT%H:%M:%SZ"`,
+		},
+		{
+			desc:    "mktime of short array",
+			program: `.a | mktime`,
+			input:   `{"a": [2015]}`,
+			err:     "mktime requires array of 6 numbers",
+		},
+		{
+			desc:    "math on string",
+			program: `.a | sqrt`,
+			input:   `{"a": "x"}`,
+			err:     `string ("x") number required`,
+		},
+		{
+			desc:    "tonumber of invalid string",
+			program: `.a | tonumber`,
+			input:   `{"a": "1x"}`,
+			err:     "Cannot parse '1x' as JSON",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := run(t, tC.program, tC.input)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %s\n", tC.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// builtin receives the input value and the unevaluated arguments of the call,
+// so that functions like select or path can decide how to run them.
+type builtin func(env *Env, o any, args []u.Node) (stream.Stream, error)
+
+// pathBuiltin is the path tracking variant of a builtin, used when the call
+// appears on the left hand side of an assignment or inside path(f).
+type pathBuiltin func(env *Env, pv pathValue, args []u.Node) ([]pathValue, error)
+
+// generator is a builtin that passes its outputs to emit as it produces
+// them, see each.
+type generator func(env *Env, o any, args []u.Node, emit func(any) error) error
+
+// builtins are keyed by name and arity, e.g. "del/1".
+var builtins = map[string]builtin{}
+
+var pathBuiltins = map[string]pathBuiltin{}
+
+var generators = map[string]generator{}
+
+func register(fs map[string]builtin) {
+	for name, f := range fs {
+		builtins[name] = f
+	}
+}
+
+// registerGenerators registers generators, which are also builtins that
+// collect their outputs where they are not evaluated by each.
+func registerGenerators(gs map[string]generator) {
+	for name, g := range gs {
+		generators[name] = g
+		builtins[name] = collect(g)
+	}
+}
+
+func collect(g generator) builtin {
+	return func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+		next := stream.New()
+		err := g(env, o, args, func(v any) error {
+			next.O = append(next.O, v)
+			return nil
+		})
+		return next, err
+	}
+}
+
+func init() {
+	register(map[string]builtin{
+		"empty/0": func(_ *Env, _ any, _ []u.Node) (stream.Stream, error) {
+			return stream.New(), nil
+		},
+		"not/0": simple(func(o any) (any, error) {
+			return !isTruthy(o), nil
+		}),
+		"_negate/0": simple(func(o any) (any, error) {
+			switch n := o.(type) {
+			case int64:
+				if n == math.MinInt64 {
+					return -float64(n), nil
+				}
+				return -n, nil
+			case float64:
+				return -n, nil
+			}
+			return nil, errorf("%s cannot be negated", describe(o))
+		}),
+		"select/1": func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+			next := stream.New()
+			conds, err := transform(env, o, args[0])
+			for _, c := range conds.O {
+				if isTruthy(c) {
+					next.O = append(next.O, o)
+				}
+			}
+			return next, err
+		},
+		"recurse/0": func(_ *Env, o any, _ []u.Node) (stream.Stream, error) {
+			next := stream.New()
+			for _, pv := range recursePaths(pathValue{value: o}) {
+				next.O = append(next.O, pv.value)
+			}
+			return next, nil
+		},
+		"path/1": func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+			return pathsOf(env, o, args[0])
+		},
+		"paths/0": func(_ *Env, o any, _ []u.Node) (stream.Stream, error) {
+			next := stream.New()
+			for _, pv := range recursePaths(pathValue{path: []any{}, value: o})[1:] {
+				next.O = append(next.O, pv.path)
+			}
+			return next, nil
+		},
+		"getpath/1": withArgs(func(o any, args []any) (any, error) {
+			p, err := toPath(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return getpath(o, p)
+		}),
+		"setpath/2": withArgs(func(o any, args []any) (any, error) {
+			p, err := toPath(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return setpath(o, p, args[1])
+		}),
+		"delpaths/1": withArgs(func(o any, args []any) (any, error) {
+			l, ok := args[0].([]any)
+			if !ok {
+				return nil, errorf("Paths must be specified as an array")
+			}
+			ps := make([][]any, 0, len(l))
+			for _, it := range l {
+				p, err := toPath(it)
+				if err != nil {
+					return nil, err
+				}
+				ps = append(ps, p)
+			}
+			return delpaths(o, ps)
+		}),
+		"del/1": func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+			pvs, err := transformPaths(env, pathValue{path: []any{}, value: o}, args[0])
+			if err != nil {
+				return stream.New(), err
+			}
+			ps := make([][]any, 0, len(pvs))
+			for _, pv := range pvs {
+				ps = append(ps, pv.path)
+			}
+			out, err := delpaths(o, ps)
+			if err != nil {
+				return stream.New(), err
+			}
+			return stream.NewS(out), nil
+		},
+	})
+
+	pathBuiltins["empty/0"] = func(_ *Env, _ pathValue, _ []u.Node) ([]pathValue, error) {
+		return nil, nil
+	}
+	pathBuiltins["select/1"] = func(env *Env, pv pathValue, args []u.Node) ([]pathValue, error) {
+		var out []pathValue
+		conds, err := transform(env, pv.value, args[0])
+		for _, c := range conds.O {
+			if isTruthy(c) {
+				out = append(out, pv)
+			}
+		}
+		return out, err
+	}
+	pathBuiltins["recurse/0"] = func(_ *Env, pv pathValue, _ []u.Node) ([]pathValue, error) {
+		return recursePaths(pv), nil
+	}
+	pathBuiltins["getpath/1"] = func(env *Env, pv pathValue, args []u.Node) ([]pathValue, error) {
+		var out []pathValue
+		ps, err := transform(env, pv.value, args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range ps.O {
+			p, err := toPath(it)
+			if err != nil {
+				return out, err
+			}
+			v, err := getpath(pv.value, p)
+			if err != nil {
+				return out, err
+			}
+			full := append(append([]any{}, pv.path...), p...)
+			out = append(out, pathValue{full, v})
+		}
+		return out, nil
+	}
+}
+
+// builtinName returns the name and arity of a call, e.g. "del/1".
+func builtinName(n u.Node) string {
+	return fmt.Sprintf("%s/%d", n.Value.Ident, len(n.Children))
+}
+
+func callBuiltin(env *Env, o any, n u.Node) (stream.Stream, error) {
+	name := builtinName(n)
+	f, ok := builtins[name]
+	if !ok {
+		return stream.New(), errorf("%s is not defined", name)
+	}
+	return f(env, o, n.Children)
+}
+
+func callPathBuiltin(env *Env, pv pathValue, n u.Node) ([]pathValue, error) {
+	name := builtinName(n)
+	f, ok := pathBuiltins[name]
+	if !ok {
+		if _, ok := builtins[name]; !ok {
+			return nil, errorf("%s is not defined", name)
+		}
+		out, err := callBuiltin(env, pv.value, n)
+		if err != nil || len(out.O) == 0 {
+			return nil, err
+		}
+		return nil, invalidPath(out.O[0])
+	}
+	return f(env, pv, n.Children)
+}
+
+// simple wraps a builtin that maps its input to exactly one output.
+func simple(f func(o any) (any, error)) builtin {
+	return func(_ *Env, o any, _ []u.Node) (stream.Stream, error) {
+		v, err := f(o)
+		if err != nil {
+			return stream.New(), err
+		}
+		return stream.NewS(v), nil
+	}
+}
+
+// withArgs wraps a builtin whose arguments are plain values. Every
+// combination of the argument outputs is passed to f, first argument
+// outermost.
+func withArgs(f func(o any, args []any) (any, error)) builtin {
+	return func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+		next := stream.New()
+		err := eachArgs(env, o, args, func(vals []any) error {
+			v, err := f(o, vals)
+			if err != nil {
+				return err
+			}
+			next.O = append(next.O, v)
+			return nil
+		})
+		return next, err
+	}
+}
+
+// eachArgs evaluates the arguments against o and calls f with every
+// combination of their outputs, first argument outermost.
+func eachArgs(env *Env, o any, args []u.Node, f func(vals []any) error) error {
+	combos := [][]any{{}}
+	for _, a := range args {
+		vals, err := transform(env, o, a)
+		if err != nil {
+			return err
+		}
+		var nextCombos [][]any
+		for _, c := range combos {
+			for _, v := range vals.O {
+				nextCombos = append(nextCombos, append(append([]any{}, c...), v))
+			}
+		}
+		combos = nextCombos
+	}
+	for _, c := range combos {
+		if err := f(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,480 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// iso8601 is the format used by todate and fromdate.
+const iso8601 = "%Y-%m-%dT%H:%M:%SZ"
+
+// brokenDown converts t to jq's broken down time: year, month (0-11), day of
+// the month, hours, minutes, seconds (fractional when needed), day of the
+// week (0 is Sunday) and day of the year (0-365).
+func brokenDown(t time.Time) []any {
+	var secs any = int64(t.Second())
+	if ns := t.Nanosecond(); ns != 0 {
+		secs = float64(t.Second()) + float64(ns)/1e9
+	}
+	return []any{
+		int64(t.Year()), int64(t.Month()) - 1, int64(t.Day()),
+		int64(t.Hour()), int64(t.Minute()), secs,
+		int64(t.Weekday()), int64(t.YearDay()) - 1,
+	}
+}
+
+// fromBrokenDown is the inverse of brokenDown. Only the first six fields are
+// used; the day of the week and of the year are derived from them.
+func fromBrokenDown(o any, name string, loc *time.Location) (time.Time, error) {
+	l, ok := o.([]any)
+	if !ok {
+		return time.Time{}, errorf("%s requires parsed datetime inputs", name)
+	}
+	if len(l) < 6 {
+		return time.Time{}, errorf("%s requires array of 6 numbers", name)
+	}
+	var fields [6]float64
+	for i := range fields {
+		f, ok := toFloat(l[i])
+		if !ok {
+			return time.Time{}, errorf("%s requires parsed datetime inputs", name)
+		}
+		fields[i] = f
+	}
+	secs, frac := math.Modf(fields[5])
+	return time.Date(int(fields[0]), time.Month(fields[1]+1), int(fields[2]),
+		int(fields[3]), int(fields[4]), int(secs), int(frac*1e9), loc), nil
+}
+
+// fromEpoch converts seconds since the Unix epoch to a time in loc.
+func fromEpoch(o any, name string, loc *time.Location) (time.Time, error) {
+	f, ok := toFloat(o)
+	if !ok {
+		return time.Time{}, errorf("%s() requires a number", name)
+	}
+	secs, frac := math.Modf(f)
+	return time.Unix(int64(secs), int64(frac*1e9)).In(loc), nil
+}
+
+// toEpoch returns the seconds of t since the epoch, as an integer when there
+// is no fractional part.
+func toEpoch(t time.Time) any {
+	if t.Nanosecond() == 0 {
+		return t.Unix()
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// timeInput accepts either seconds since the epoch or a broken down time, as
+// strftime does.
+func timeInput(o any, name string, loc *time.Location) (time.Time, error) {
+	if isNumber(o) {
+		return fromEpoch(o, name, loc)
+	}
+	return fromBrokenDown(o, name, loc)
+}
+
+func strftime(name string, loc *time.Location) builtin {
+	return withArgs(func(o any, args []any) (any, error) {
+		format, ok := args[0].(string)
+		if !ok {
+			return nil, errorf("%s requires a string format", name)
+		}
+		t, err := timeInput(o, name, loc)
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(t, format), nil
+	})
+}
+
+// formatTime implements the conversions of C's strftime.
+func formatTime(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%d", t.Year())
+		case 'C':
+			fmt.Fprintf(&b, "%02d", t.Year()/100)
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'G':
+			y, _ := t.ISOWeek()
+			fmt.Fprintf(&b, "%d", y)
+		case 'g':
+			y, _ := t.ISOWeek()
+			fmt.Fprintf(&b, "%02d", y%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'b', 'h':
+			b.WriteString(t.Month().String()[:3])
+		case 'B':
+			b.WriteString(t.Month().String())
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&b, "%2d", t.Day())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'a':
+			b.WriteString(t.Weekday().String()[:3])
+		case 'A':
+			b.WriteString(t.Weekday().String())
+		case 'u':
+			fmt.Fprintf(&b, "%d", (int(t.Weekday())+6)%7+1)
+		case 'w':
+			fmt.Fprintf(&b, "%d", int(t.Weekday()))
+		case 'U':
+			fmt.Fprintf(&b, "%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+		case 'W':
+			fmt.Fprintf(&b, "%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+		case 'V':
+			_, w := t.ISOWeek()
+			fmt.Fprintf(&b, "%02d", w)
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'k':
+			fmt.Fprintf(&b, "%2d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&b, "%02d", (t.Hour()+11)%12+1)
+		case 'l':
+			fmt.Fprintf(&b, "%2d", (t.Hour()+11)%12+1)
+		case 'p':
+			if t.Hour() < 12 {
+				b.WriteString("AM")
+			} else {
+				b.WriteString("PM")
+			}
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case 'Z':
+			name, _ := t.Zone()
+			b.WriteString(name)
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'c':
+			b.WriteString(formatTime(t, "%a %b %e %H:%M:%S %Y"))
+		case 'D', 'x':
+			b.WriteString(formatTime(t, "%m/%d/%y"))
+		case 'F':
+			b.WriteString(formatTime(t, "%Y-%m-%d"))
+		case 'T', 'X':
+			b.WriteString(formatTime(t, "%H:%M:%S"))
+		case 'R':
+			b.WriteString(formatTime(t, "%H:%M"))
+		case 'r':
+			b.WriteString(formatTime(t, "%I:%M:%S %p"))
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+var (
+	monthNames = []string{"january", "february", "march", "april", "may", "june",
+		"july", "august", "september", "october", "november", "december"}
+	dayNames = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+)
+
+// timeParser holds the state of parseTime. Fields missing from the format
+// default to 1900-01-01 00:00:00, as with a zeroed struct tm.
+type timeParser struct {
+	s                        string
+	year, month, day         int
+	hour, minute, second     int
+	pm, hasPM                bool
+	epoch                    *int64
+	century, yearOfCentury   int
+	hasCentury, hasShortYear bool
+}
+
+// parseTime implements the conversions of C's strptime. Whitespace in the
+// format matches any amount of whitespace, and like jq with glibc the zone
+// given by %z or %Z is accepted but ignored.
+func parseTime(s, format string) (time.Time, bool) {
+	p := &timeParser{s: s, year: 1900, day: 1}
+	if !p.parse(format) || strings.TrimSpace(p.s) != "" {
+		return time.Time{}, false
+	}
+	if p.epoch != nil {
+		return time.Unix(*p.epoch, 0).UTC(), true
+	}
+	if p.hasShortYear {
+		switch {
+		case p.hasCentury:
+			p.year = p.century*100 + p.yearOfCentury
+		case p.yearOfCentury < 69:
+			p.year = 2000 + p.yearOfCentury
+		default:
+			p.year = 1900 + p.yearOfCentury
+		}
+	}
+	if p.hasPM {
+		p.hour %= 12
+		if p.pm {
+			p.hour += 12
+		}
+	}
+	return time.Date(p.year, time.Month(p.month+1), p.day, p.hour, p.minute, p.second, 0, time.UTC), true
+}
+
+func (p *timeParser) parse(format string) bool {
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if isSpace(c) {
+			p.s = strings.TrimLeftFunc(p.s, unicode.IsSpace)
+			continue
+		}
+		if c != '%' || i+1 == len(format) {
+			if !strings.HasPrefix(p.s, string(c)) {
+				return false
+			}
+			p.s = p.s[1:]
+			continue
+		}
+		i++
+		if !p.conversion(format[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *timeParser) conversion(c byte) bool {
+	var ok bool
+	switch c {
+	case 'Y':
+		p.year, ok = p.number(4, true)
+	case 'C':
+		p.century, ok = p.number(2, false)
+		p.hasCentury = true
+	case 'y':
+		p.yearOfCentury, ok = p.number(2, false)
+		p.hasShortYear = true
+	case 'm':
+		p.month, ok = p.number(2, false)
+		p.month--
+	case 'd', 'e':
+		p.day, ok = p.number(2, false)
+	case 'j':
+		var yday int
+		yday, ok = p.number(3, false)
+		p.month, p.day = 0, yday
+	case 'H', 'k', 'I', 'l':
+		p.hour, ok = p.number(2, false)
+	case 'M':
+		p.minute, ok = p.number(2, false)
+	case 'S':
+		p.second, ok = p.number(2, false)
+	case 's':
+		var n int
+		n, ok = p.number(19, true)
+		epoch := int64(n)
+		p.epoch = &epoch
+	case 'b', 'B', 'h':
+		p.month, ok = p.name(monthNames)
+	case 'a', 'A':
+		_, ok = p.name(dayNames)
+	case 'p':
+		switch {
+		case hasPrefixFold(p.s, "am"):
+			p.pm, ok = false, true
+		case hasPrefixFold(p.s, "pm"):
+			p.pm, ok = true, true
+		}
+		if ok {
+			p.hasPM = true
+			p.s = p.s[2:]
+		}
+	case 'z':
+		ok = p.zoneOffset()
+	case 'Z':
+		n := len(p.s) - len(strings.TrimLeftFunc(p.s, unicode.IsLetter))
+		p.s, ok = p.s[n:], true
+	case 'T':
+		ok = p.parse("%H:%M:%S")
+	case 'R':
+		ok = p.parse("%H:%M")
+	case 'D':
+		ok = p.parse("%m/%d/%y")
+	case 'F':
+		ok = p.parse("%Y-%m-%d")
+	case 'c':
+		ok = p.parse("%a %b %e %H:%M:%S %Y")
+	case 'n', 't':
+		p.s, ok = strings.TrimLeftFunc(p.s, unicode.IsSpace), true
+	case '%':
+		if strings.HasPrefix(p.s, "%") {
+			p.s, ok = p.s[1:], true
+		}
+	}
+	return ok
+}
+
+// number reads up to width digits, skipping leading whitespace.
+func (p *timeParser) number(width int, signed bool) (int, bool) {
+	s := strings.TrimLeftFunc(p.s, unicode.IsSpace)
+	n := 0
+	if signed && n < len(s) && (s[n] == '-' || s[n] == '+') {
+		n++
+	}
+	start := n
+	for n < len(s) && n-start < width && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n == start {
+		return 0, false
+	}
+	v, err := strconv.Atoi(s[:n])
+	if err != nil {
+		return 0, false
+	}
+	p.s = s[n:]
+	return v, true
+}
+
+// name matches a full or abbreviated name, case insensitively, and returns
+// its position in names.
+func (p *timeParser) name(names []string) (int, bool) {
+	for i, n := range names {
+		if hasPrefixFold(p.s, n) {
+			p.s = p.s[len(n):]
+			return i, true
+		}
+	}
+	for i, n := range names {
+		if hasPrefixFold(p.s, n[:3]) {
+			p.s = p.s[3:]
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (p *timeParser) zoneOffset() bool {
+	if hasPrefixFold(p.s, "z") {
+		p.s = p.s[1:]
+		return true
+	}
+	if p.s == "" || (p.s[0] != '+' && p.s[0] != '-') {
+		return false
+	}
+	n := 1
+	for n < len(p.s) && n < 6 && (p.s[n] == ':' || (p.s[n] >= '0' && p.s[n] <= '9')) {
+		n++
+	}
+	if n < 3 {
+		return false
+	}
+	p.s = p.s[n:]
+	return true
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func strptime(o any, format any) (time.Time, error) {
+	s, ok := o.(string)
+	f, fok := format.(string)
+	if !ok || !fok {
+		return time.Time{}, errorf("strptime/1 requires string inputs and arguments")
+	}
+	t, ok := parseTime(s, f)
+	if !ok {
+		return time.Time{}, errorf("date %q does not match format %q", s, f)
+	}
+	return t, nil
+}
+
+func todate(o any) (any, error) {
+	t, err := timeInput(o, "strftime/1", time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	return formatTime(t, iso8601), nil
+}
+
+func fromdate(o any) (any, error) {
+	t, err := strptime(o, iso8601)
+	if err != nil {
+		return nil, err
+	}
+	return t.Unix(), nil
+}
+
+func init() {
+	register(map[string]builtin{
+		"now/0": simple(func(_ any) (any, error) {
+			return toEpoch(time.Now()), nil
+		}),
+		"gmtime/0": simple(func(o any) (any, error) {
+			t, err := fromEpoch(o, "gmtime", time.UTC)
+			if err != nil {
+				return nil, err
+			}
+			return brokenDown(t), nil
+		}),
+		"localtime/0": simple(func(o any) (any, error) {
+			t, err := fromEpoch(o, "localtime", time.Local)
+			if err != nil {
+				return nil, err
+			}
+			return brokenDown(t), nil
+		}),
+		"mktime/0": simple(func(o any) (any, error) {
+			t, err := fromBrokenDown(o, "mktime", time.UTC)
+			if err != nil {
+				return nil, err
+			}
+			return t.Unix(), nil
+		}),
+		"strftime/1":      strftime("strftime/1", time.UTC),
+		"strflocaltime/1": strftime("strflocaltime/1", time.Local),
+		"strptime/1": withArgs(func(o any, args []any) (any, error) {
+			t, err := strptime(o, args[0])
+			if err != nil {
+				return nil, err
+			}
+			return brokenDown(t), nil
+		}),
+		"todate/0":          simple(todate),
+		"todateiso8601/0":   simple(todate),
+		"date/0":            simple(todate),
+		"fromdate/0":        simple(fromdate),
+		"fromdateiso8601/0": simple(fromdate),
+		"dateadd/2": withArgs(func(o any, args []any) (any, error) {
+			return arithmetic("+", o, args[1])
+		}),
+		"datesub/2": withArgs(func(o any, args []any) (any, error) {
+			return arithmetic("-", o, args[1])
+		}),
+	})
+}
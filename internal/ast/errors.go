@@ -0,0 +1,83 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// ValueError is raised while evaluating a program. It carries an arbitrary
+// JSON value, which is what `catch` receives.
+type ValueError struct {
+	Value any
+}
+
+func (e *ValueError) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%s (not a string)", gqjson.NewJSON(e.Value).Compact())
+}
+
+// errorf builds an evaluation error with a string value. Messages follow jq's
+// wording, so they start with a capital letter unlike regular Go errors.
+func errorf(format string, args ...any) error {
+	return &ValueError{Value: fmt.Sprintf(format, args...)}
+}
+
+// errorValue returns the value a `catch` handler receives for err.
+func errorValue(err error) any {
+	var ve *ValueError
+	if errors.As(err, &ve) {
+		return ve.Value
+	}
+	return err.Error()
+}
+
+// tryValue emits the outputs of the body up to its first error, then the
+// outputs of the handler applied to the error value, if there is one.
+func tryValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	out, err := transform(env, o, n.Children[0])
+	if isHalt(err) {
+		return out, err
+	}
+	if err == nil || len(n.Children) < 2 {
+		return out, nil
+	}
+	handled, err := transform(env, errorValue(err), n.Children[1])
+	out.O = append(out.O, handled.O...)
+	return out, err
+}
+
+func tryPaths(env *Env, pv pathValue, n u.Node) ([]pathValue, error) {
+	out, err := transformPaths(env, pv, n.Children[0])
+	if isHalt(err) {
+		return out, err
+	}
+	if err == nil || len(n.Children) < 2 {
+		return out, nil
+	}
+	handled, err := transformPaths(env, pathValue{path: pv.path, value: errorValue(err)}, n.Children[1])
+	return append(out, handled...), err
+}
+
+func init() {
+	register(map[string]builtin{
+		"error/0": func(_ *Env, o any, _ []u.Node) (stream.Stream, error) {
+			return stream.New(), &ValueError{Value: o}
+		},
+		"error/1": func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+			msgs, err := transform(env, o, args[0])
+			if err != nil {
+				return stream.New(), err
+			}
+			if len(msgs.O) == 0 {
+				return stream.New(), nil
+			}
+			return stream.New(), &ValueError{Value: msgs.O[0]}
+		},
+	})
+}
@@ -0,0 +1,183 @@
+package ast
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// formatter renders a value as a string for `@name`.
+type formatter func(o any) (string, error)
+
+var formats = map[string]formatter{
+	"text": func(o any) (string, error) {
+		return toString(o), nil
+	},
+	"json": func(o any) (string, error) {
+		return gqjson.NewJSON(o).Compact(), nil
+	},
+	"html": func(o any) (string, error) {
+		return htmlReplacer.Replace(toString(o)), nil
+	},
+	"uri": func(o any) (string, error) {
+		return escapeURI(toString(o)), nil
+	},
+	"csv": func(o any) (string, error) {
+		return joinRow(o, "csv", ",", func(s string) string {
+			return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+		})
+	},
+	"tsv": func(o any) (string, error) {
+		return joinRow(o, "tsv", "\t", tsvReplacer.Replace)
+	},
+	"sh": func(o any) (string, error) {
+		l, ok := o.([]any)
+		if !ok {
+			l = []any{o}
+		}
+		parts := make([]string, 0, len(l))
+		for _, it := range l {
+			switch it := it.(type) {
+			case string:
+				parts = append(parts, "'"+strings.ReplaceAll(it, "'", `'\''`)+"'")
+			case []any, *gqjson.Object:
+				return "", errorf("%s can not be escaped for shell", describe(it))
+			default:
+				parts = append(parts, toString(it))
+			}
+		}
+		return strings.Join(parts, " "), nil
+	},
+	"base64": func(o any) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(toString(o))), nil
+	},
+	"base64d": func(o any) (string, error) {
+		s := strings.TrimRight(toString(o), "=")
+		b, err := base64.RawStdEncoding.DecodeString(s)
+		if err != nil {
+			return "", errorf("%s is not valid base64 data", describe(o))
+		}
+		return string(b), nil
+	},
+}
+
+var htmlReplacer = strings.NewReplacer("<", "&lt;", ">", "&gt;", "&", "&amp;", "'", "&#39;", `"`, "&quot;")
+
+var tsvReplacer = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// toString returns strings unchanged and encodes every other value as JSON.
+func toString(o any) string {
+	if s, ok := o.(string); ok {
+		return s
+	}
+	return gqjson.NewJSON(o).Compact()
+}
+
+func escapeURI(s string) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		if isUnreserved(b) {
+			sb.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", b)
+	}
+	return sb.String()
+}
+
+func isUnreserved(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') ||
+		b == '-' || b == '_' || b == '.' || b == '~'
+}
+
+// joinRow renders an array as a csv or tsv row. Strings are escaped with
+// quote, other scalars are written as is and null becomes an empty field.
+func joinRow(o any, name, sep string, quote func(string) string) (string, error) {
+	l, ok := o.([]any)
+	if !ok {
+		return "", errorf("%s cannot be %s-formatted, only an array can be", describe(o), name)
+	}
+	fields := make([]string, 0, len(l))
+	for _, it := range l {
+		switch it := it.(type) {
+		case nil:
+			fields = append(fields, "")
+		case string:
+			fields = append(fields, quote(it))
+		case []any, *gqjson.Object:
+			return "", errorf("%s is not valid in a %s row", describe(it), name)
+		default:
+			fields = append(fields, toString(it))
+		}
+	}
+	return strings.Join(fields, sep), nil
+}
+
+func getFormat(name string) (formatter, error) {
+	f, ok := formats[name]
+	if !ok {
+		return nil, errorf("%s is not a valid format", name)
+	}
+	return f, nil
+}
+
+// formatValue evaluates an interpolated string, whose children alternate
+// between literal text and expressions. Every expression is evaluated against
+// the input and rendered with the format; one string is produced for each
+// combination of outputs, with the later parts varying slowest as in jq.
+func formatValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	f, err := getFormat(n.Value.Ident)
+	if err != nil {
+		return next, err
+	}
+	results := []string{""}
+	for i, c := range n.Children {
+		if i%2 == 0 {
+			s, _ := c.Value.Literal.(string)
+			for j := range results {
+				results[j] += s
+			}
+			continue
+		}
+		outs, err := transform(env, o, c)
+		if err != nil {
+			return next, err
+		}
+		var nextResults []string
+		for _, v := range outs.O {
+			s, err := f(v)
+			if err != nil {
+				return next, err
+			}
+			for _, r := range results {
+				nextResults = append(nextResults, r+s)
+			}
+		}
+		results = nextResults
+	}
+	for _, r := range results {
+		next.O = append(next.O, r)
+	}
+	return next, nil
+}
+
+func init() {
+	register(map[string]builtin{
+		"format/1": withArgs(func(o any, args []any) (any, error) {
+			name, ok := args[0].(string)
+			if !ok {
+				return nil, errorf("%s is not a valid format", describe(args[0]))
+			}
+			f, err := getFormat(name)
+			if err != nil {
+				return nil, err
+			}
+			return f(o)
+		}),
+	})
+}
@@ -0,0 +1,51 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Halt stops the whole program, as raised by halt and halt_error. Unlike a
+// ValueError, it cannot be caught with try or suppressed by `//`.
+type Halt struct {
+	Code int
+	// Value is the input of halt_error, which is reported on stderr
+	Value    any
+	HasValue bool
+}
+
+func (h *Halt) Error() string {
+	return fmt.Sprintf("halted with exit code %d", h.Code)
+}
+
+func isHalt(err error) bool {
+	var h *Halt
+	return errors.As(err, &h)
+}
+
+func haltError(o any, code any) (any, error) {
+	var c int
+	switch n := code.(type) {
+	case int64:
+		c = int(n)
+	case float64:
+		c = int(n)
+	default:
+		return nil, errorf("halt_error/1: number required")
+	}
+	return nil, &Halt{Code: c, Value: o, HasValue: true}
+}
+
+func init() {
+	register(map[string]builtin{
+		"halt/0": simple(func(_ any) (any, error) {
+			return nil, &Halt{}
+		}),
+		"halt_error/0": simple(func(o any) (any, error) {
+			return haltError(o, int64(5))
+		}),
+		"halt_error/1": withArgs(func(o any, args []any) (any, error) {
+			return haltError(o, args[0])
+		}),
+	})
+}
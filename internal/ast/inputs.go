@@ -0,0 +1,85 @@
+package ast
+
+import (
+	"io"
+
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// Inputs is where the input and inputs builtins read the inputs from that
+// the program is not being run on.
+type Inputs interface {
+	// Next returns the next input, or io.EOF when there are none left.
+	Next() (any, error)
+	// Filename returns the name of the file being read, or nil for stdin.
+	Filename() any
+	// LineNumber returns how many lines of the current file were read.
+	LineNumber() int64
+}
+
+// WithInputs returns env with in as the source of the input builtins.
+// Without one, programs behave as if all inputs were already consumed.
+func (env *Env) WithInputs(in Inputs) *Env {
+	out := &Env{inputs: in}
+	if env != nil {
+		out.vars = env.vars
+	}
+	return out
+}
+
+// nextInput returns the next input. ok is false once they are exhausted.
+func (env *Env) nextInput() (v any, ok bool, err error) {
+	if env == nil || env.inputs == nil {
+		return nil, false, nil
+	}
+	v, err = env.inputs.Next()
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errorf("%s", err)
+	}
+	return v, true, nil
+}
+
+func init() {
+	register(map[string]builtin{
+		"input/0": func(env *Env, _ any, _ []u.Node) (stream.Stream, error) {
+			v, ok, err := env.nextInput()
+			if err != nil {
+				return stream.New(), err
+			}
+			if !ok {
+				return stream.New(), errorf("No more inputs")
+			}
+			return stream.NewS(v), nil
+		},
+		"input_filename/0": func(env *Env, _ any, _ []u.Node) (stream.Stream, error) {
+			if env == nil || env.inputs == nil {
+				return stream.NewS(nil), nil
+			}
+			return stream.NewS(env.inputs.Filename()), nil
+		},
+		"input_line_number/0": func(env *Env, _ any, _ []u.Node) (stream.Stream, error) {
+			if env == nil || env.inputs == nil {
+				return stream.NewS(int64(0)), nil
+			}
+			return stream.NewS(env.inputs.LineNumber()), nil
+		},
+	})
+
+	registerGenerators(map[string]generator{
+		"inputs/0": func(env *Env, _ any, _ []u.Node, emit func(any) error) error {
+			for {
+				v, ok, err := env.nextInput()
+				if err != nil || !ok {
+					return err
+				}
+				if err := emit(v); err != nil {
+					return err
+				}
+			}
+		},
+	})
+}
@@ -0,0 +1,173 @@
+package ast
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// fromFloat returns f as an int64 when it is a whole number that fits, so
+// that rounding functions keep integer results exact.
+func fromFloat(f float64) any {
+	if f == math.Trunc(f) && f >= -(1<<63) && f < 1<<63 {
+		return int64(f)
+	}
+	return f
+}
+
+// mathBuiltin wraps a C math function taking one number.
+func mathBuiltin(f func(float64) float64) builtin {
+	return simple(func(o any) (any, error) {
+		x, ok := toFloat(o)
+		if !ok {
+			return nil, errorf("%s number required", describe(o))
+		}
+		return f(x), nil
+	})
+}
+
+// mathBuiltin2 wraps a C math function taking two numbers as arguments.
+func mathBuiltin2(f func(float64, float64) float64) builtin {
+	return withArgs(func(_ any, args []any) (any, error) {
+		x, ok := toFloat(args[0])
+		if !ok {
+			return nil, errorf("%s number required", describe(args[0]))
+		}
+		y, ok := toFloat(args[1])
+		if !ok {
+			return nil, errorf("%s number required", describe(args[1]))
+		}
+		return f(x, y), nil
+	})
+}
+
+func mathPredicate(f func(float64) bool) builtin {
+	return simple(func(o any) (any, error) {
+		x, ok := toFloat(o)
+		if !ok {
+			return nil, errorf("%s number required", describe(o))
+		}
+		return f(x), nil
+	})
+}
+
+// roundBuiltin wraps a rounding function. Integers are returned unchanged and
+// whole results are converted back to integers.
+func roundBuiltin(f func(float64) float64) builtin {
+	return simple(func(o any) (any, error) {
+		if i, ok := o.(int64); ok {
+			return i, nil
+		}
+		x, ok := toFloat(o)
+		if !ok {
+			return nil, errorf("%s number required", describe(o))
+		}
+		return fromFloat(f(x)), nil
+	})
+}
+
+// significand returns the mantissa of x scaled to [1, 2).
+func significand(x float64) float64 {
+	if x == 0 || math.IsInf(x, 0) || math.IsNaN(x) {
+		return x
+	}
+	frac, _ := math.Frexp(x)
+	return frac * 2
+}
+
+func isNormal(x float64) bool {
+	if x == 0 || math.IsInf(x, 0) || math.IsNaN(x) {
+		return false
+	}
+	return math.Abs(x) >= 0x1p-1022
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// tonumber parses a string with the same rules as JSON input, keeping
+// integers exact.
+func tonumber(o any) (any, error) {
+	switch o := o.(type) {
+	case int64, float64:
+		return o, nil
+	case string:
+		if !jsonNumber.MatchString(o) {
+			return nil, errorf("Cannot parse '%s' as JSON", o)
+		}
+		if i, err := strconv.ParseInt(o, 10, 64); err == nil {
+			return i, nil
+		}
+		f, _ := strconv.ParseFloat(o, 64)
+		return f, nil
+	}
+	return nil, errorf("%s cannot be parsed as a number", describe(o))
+}
+
+// absolute returns the absolute value of a number, and whether o is one. The
+// absolute value of math.MinInt64 does not fit an int64 and is a float.
+func absolute(o any) (any, bool) {
+	switch n := o.(type) {
+	case int64:
+		if n == math.MinInt64 {
+			return -float64(n), true
+		}
+		if n < 0 {
+			return -n, true
+		}
+		return n, true
+	case float64:
+		return math.Abs(n), true
+	}
+	return nil, false
+}
+
+func init() {
+	register(map[string]builtin{
+		"floor/0": roundBuiltin(math.Floor),
+		"ceil/0":  roundBuiltin(math.Ceil),
+		"round/0": roundBuiltin(math.Round),
+		"trunc/0": roundBuiltin(math.Trunc),
+		"abs/0": simple(func(o any) (any, error) {
+			if v, ok := absolute(o); ok {
+				return v, nil
+			}
+			return nil, errorf("%s has no absolute value", describe(o))
+		}),
+		"fabs/0":        mathBuiltin(math.Abs),
+		"sqrt/0":        mathBuiltin(math.Sqrt),
+		"cbrt/0":        mathBuiltin(math.Cbrt),
+		"exp/0":         mathBuiltin(math.Exp),
+		"exp2/0":        mathBuiltin(math.Exp2),
+		"exp10/0":       mathBuiltin(func(x float64) float64 { return math.Pow(10, x) }),
+		"expm1/0":       mathBuiltin(math.Expm1),
+		"log/0":         mathBuiltin(math.Log),
+		"log2/0":        mathBuiltin(math.Log2),
+		"log10/0":       mathBuiltin(math.Log10),
+		"log1p/0":       mathBuiltin(math.Log1p),
+		"sin/0":         mathBuiltin(math.Sin),
+		"cos/0":         mathBuiltin(math.Cos),
+		"tan/0":         mathBuiltin(math.Tan),
+		"asin/0":        mathBuiltin(math.Asin),
+		"acos/0":        mathBuiltin(math.Acos),
+		"atan/0":        mathBuiltin(math.Atan),
+		"sinh/0":        mathBuiltin(math.Sinh),
+		"cosh/0":        mathBuiltin(math.Cosh),
+		"tanh/0":        mathBuiltin(math.Tanh),
+		"significand/0": mathBuiltin(significand),
+		"pow/2":         mathBuiltin2(math.Pow),
+		"atan2/2":       mathBuiltin2(math.Atan2),
+		"fmin/2":        mathBuiltin2(math.Min),
+		"fmax/2":        mathBuiltin2(math.Max),
+		"fmod/2":        mathBuiltin2(math.Mod),
+		"infinite/0": simple(func(_ any) (any, error) {
+			return math.Inf(1), nil
+		}),
+		"nan/0": simple(func(_ any) (any, error) {
+			return math.NaN(), nil
+		}),
+		"isinfinite/0": mathPredicate(func(x float64) bool { return math.IsInf(x, 0) }),
+		"isnan/0":      mathPredicate(math.IsNaN),
+		"isnormal/0":   mathPredicate(isNormal),
+		"tonumber/0":   simple(tonumber),
+	})
+}
@@ -0,0 +1,443 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+func typeName(o any) string {
+	switch o.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64, float64, int:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case *gqjson.Object:
+		return "object"
+	}
+	return fmt.Sprintf("%T", o)
+}
+
+// describe renders a value for error messages, e.g. `number (5)`. Long values
+// are truncated the same way jq does.
+func describe(o any) string {
+	if o == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%s (%s)", typeName(o), truncate(gqjson.NewJSON(o).Compact()))
+}
+
+func truncate(s string) string {
+	const limit = 11
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit-1] + "..."
+}
+
+func isTruthy(o any) bool {
+	switch o := o.(type) {
+	case nil:
+		return false
+	case bool:
+		return o
+	}
+	return true
+}
+
+func toFloat(o any) (float64, bool) {
+	switch n := o.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func toInt(o any) (int, bool) {
+	switch n := o.(type) {
+	case int64:
+		return int(n), true
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+func isNumber(o any) bool {
+	_, ok := toFloat(o)
+	return ok
+}
+
+// order ranks types the way jq sorts them.
+func order(o any) int {
+	switch o := o.(type) {
+	case nil:
+		return 0
+	case bool:
+		if o {
+			return 2
+		}
+		return 1
+	case int64, float64, int:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	case *gqjson.Object:
+		return 6
+	}
+	return 7
+}
+
+// compareValues returns a negative number, zero or a positive number when a
+// sorts before, equal to or after b.
+func compareValues(a, b any) int {
+	oa, ob := order(a), order(b)
+	if oa != ob {
+		return oa - ob
+	}
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case []any:
+		b := b.([]any)
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compareValues(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return len(a) - len(b)
+	case *gqjson.Object:
+		b := b.(*gqjson.Object)
+		ka, kb := sortedKeys(a), sortedKeys(b)
+		if c := compareValues(stringsToAny(ka), stringsToAny(kb)); c != 0 {
+			return c
+		}
+		for _, k := range ka {
+			va, _ := a.Get(k)
+			vb, _ := b.Get(k)
+			if c := compareValues(va, vb); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	if isNumber(a) {
+		if ia, ok := a.(int64); ok {
+			if ib, ok := b.(int64); ok {
+				return compareInts(ia, ib)
+			}
+		}
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		switch {
+		case math.IsNaN(fa):
+			// jq sorts nan below every number, including itself.
+			return -1
+		case math.IsNaN(fb):
+			return 1
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func stringsToAny(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+// binopValue evaluates both operands against the same input. Like jq, the
+// right hand side drives the outer loop of the cartesian product.
+func binopValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	rights, err := transform(env, o, n.Children[1])
+	if err != nil {
+		return next, err
+	}
+	lefts, err := transform(env, o, n.Children[0])
+	if err != nil {
+		return next, err
+	}
+	for _, r := range rights.O {
+		for _, l := range lefts.O {
+			v, err := binop(n.Value.Ident, l, r)
+			if err != nil {
+				return next, err
+			}
+			next.O = append(next.O, v)
+		}
+	}
+	return next, nil
+}
+
+func binop(op string, l, r any) (any, error) {
+	switch op {
+	case "==":
+		return compareValues(l, r) == 0, nil
+	case "!=":
+		return compareValues(l, r) != 0, nil
+	case "<":
+		return compareValues(l, r) < 0, nil
+	case "<=":
+		return compareValues(l, r) <= 0, nil
+	case ">":
+		return compareValues(l, r) > 0, nil
+	case ">=":
+		return compareValues(l, r) >= 0, nil
+	}
+	return arithmetic(op, l, r)
+}
+
+var opVerbs = map[string]string{
+	"+": "added",
+	"-": "subtracted",
+	"*": "multiplied",
+	"/": "divided",
+	"%": "divided",
+}
+
+func arithmetic(op string, l, r any) (any, error) {
+	if isNumber(l) && isNumber(r) {
+		return arithmeticNumbers(op, l, r)
+	}
+	switch op {
+	case "+":
+		if l == nil {
+			return r, nil
+		}
+		if r == nil {
+			return l, nil
+		}
+		switch l := l.(type) {
+		case string:
+			if r, ok := r.(string); ok {
+				return l + r, nil
+			}
+		case []any:
+			if r, ok := r.([]any); ok {
+				return append(cloneList(l), r...), nil
+			}
+		case *gqjson.Object:
+			if r, ok := r.(*gqjson.Object); ok {
+				m := l.Clone()
+				for k, v := range r.All() {
+					m.Set(k, v)
+				}
+				return m, nil
+			}
+		}
+	case "-":
+		if l, ok := l.([]any); ok {
+			if r, ok := r.([]any); ok {
+				return subtractList(l, r), nil
+			}
+		}
+	case "*":
+		if s, ok := l.(string); ok && isNumber(r) {
+			return repeatString(s, r), nil
+		}
+		if s, ok := r.(string); ok && isNumber(l) {
+			return repeatString(s, l), nil
+		}
+		if l, ok := l.(*gqjson.Object); ok {
+			if r, ok := r.(*gqjson.Object); ok {
+				return deepMerge(l, r), nil
+			}
+		}
+	case "/":
+		if l, ok := l.(string); ok {
+			if r, ok := r.(string); ok {
+				return splitString(l, r), nil
+			}
+		}
+	}
+	return nil, errorf("%s and %s cannot be %s", describe(l), describe(r), opVerbs[op])
+}
+
+// arithmeticNumbers keeps integer results exact when both operands are
+// integers and the result fits, falling back to float64 otherwise.
+func arithmeticNumbers(op string, l, r any) (any, error) {
+	li, lok := l.(int64)
+	ri, rok := r.(int64)
+	lf, _ := toFloat(l)
+	rf, _ := toFloat(r)
+	ints := lok && rok
+
+	switch op {
+	case "+":
+		if ints {
+			if s := li + ri; (s > li) == (ri > 0) {
+				return s, nil
+			}
+		}
+		return lf + rf, nil
+	case "-":
+		if ints {
+			if d := li - ri; (d < li) == (ri > 0) {
+				return d, nil
+			}
+		}
+		return lf - rf, nil
+	case "*":
+		// the check by division misses MinInt64 * -1, which wraps to itself
+		minByNeg := li == -1 && ri == math.MinInt64 || ri == -1 && li == math.MinInt64
+		if ints && !minByNeg && (li == 0 || (li*ri)/li == ri) {
+			return li * ri, nil
+		}
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errorf("%s and %s cannot be divided because the divisor is zero", describe(l), describe(r))
+		}
+		if ints && li%ri == 0 && !(li == math.MinInt64 && ri == -1) {
+			return li / ri, nil
+		}
+		return lf / rf, nil
+	case "%":
+		if math.IsNaN(lf) || math.IsNaN(rf) {
+			return math.NaN(), nil
+		}
+		a, b := int64(lf), int64(rf)
+		if b == 0 {
+			return nil, errorf("%s and %s cannot be divided because the divisor is zero", describe(l), describe(r))
+		}
+		if b < 0 {
+			b = -b
+		}
+		return a % b, nil
+	}
+	return nil, errorf("unknown operator %s", op)
+}
+
+func subtractList(l, r []any) []any {
+	out := []any{}
+	for _, it := range l {
+		found := false
+		for _, rm := range r {
+			if compareValues(it, rm) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func repeatString(s string, n any) any {
+	f, _ := toFloat(n)
+	if f <= 0 {
+		return nil
+	}
+	count := int(f)
+	if count < 1 {
+		count = 1
+	}
+	return strings.Repeat(s, count)
+}
+
+func deepMerge(l, r *gqjson.Object) *gqjson.Object {
+	m := l.Clone()
+	for k, v := range r.All() {
+		prev, _ := m.Get(k)
+		lv, lok := prev.(*gqjson.Object)
+		rv, rok := v.(*gqjson.Object)
+		if lok && rok {
+			m.Set(k, deepMerge(lv, rv))
+			continue
+		}
+		m.Set(k, v)
+	}
+	return m
+}
+
+func splitString(s, sep string) []any {
+	out := []any{}
+	if s == "" {
+		return out
+	}
+	for _, part := range strings.Split(s, sep) {
+		out = append(out, part)
+	}
+	return out
+}
+
+// logicValue implements `and` and `or`, only evaluating the right hand side
+// when the left one does not decide the result.
+func logicValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	lefts, err := transform(env, o, n.Children[0])
+	if err != nil {
+		return next, err
+	}
+	isOr := n.Value.Kind == u.OR
+	for _, l := range lefts.O {
+		if isTruthy(l) == isOr {
+			next.O = append(next.O, isOr)
+			continue
+		}
+		rights, err := transform(env, o, n.Children[1])
+		if err != nil {
+			return next, err
+		}
+		for _, r := range rights.O {
+			next.O = append(next.O, isTruthy(r))
+		}
+	}
+	return next, nil
+}
+
+// alternativeValue implements `a // b`: the truthy outputs of a, or the
+// outputs of b when there are none. Errors raised by a are suppressed.
+func alternativeValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	lefts, err := transform(env, o, n.Children[0])
+	for _, l := range lefts.O {
+		if isTruthy(l) {
+			next.O = append(next.O, l)
+		}
+	}
+	if isHalt(err) {
+		return next, err
+	}
+	if len(next.O) > 0 {
+		return next, nil
+	}
+	return transform(env, o, n.Children[1])
+}
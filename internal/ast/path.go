@@ -0,0 +1,350 @@
+package ast
+
+import (
+	"sort"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// pathValue is a value together with its location inside the program input.
+type pathValue struct {
+	path  []any
+	value any
+}
+
+func appendPath(p []any, k any) []any {
+	np := make([]any, len(p), len(p)+1)
+	copy(np, p)
+	return append(np, k)
+}
+
+// transformPaths evaluates a path expression such as `.a[].b` or
+// `.. | select(f)`, tracking where each output was found. Expressions that
+// build new values have no location and are rejected.
+func transformPaths(env *Env, pv pathValue, n u.Node) ([]pathValue, error) {
+	switch n.Value.Kind {
+	case u.IDX:
+		return indexPaths(pv, n.Value)
+	case u.PIPE:
+		lefts, err := transformPaths(env, pv, n.Children[0])
+		var out []pathValue
+		for _, l := range lefts {
+			rights, rerr := transformPaths(env, l, n.Children[1])
+			out = append(out, rights...)
+			if rerr != nil {
+				return out, rerr
+			}
+		}
+		return out, err
+	case u.COMMA:
+		left, err := transformPaths(env, pv, n.Children[0])
+		if err != nil {
+			return left, err
+		}
+		right, err := transformPaths(env, pv, n.Children[1])
+		return append(left, right...), err
+	case u.ALT:
+		lefts, err := transformPaths(env, pv, n.Children[0])
+		var out []pathValue
+		for _, l := range lefts {
+			if isTruthy(l.value) {
+				out = append(out, l)
+			}
+		}
+		if isHalt(err) {
+			return out, err
+		}
+		if len(out) > 0 {
+			return out, nil
+		}
+		return transformPaths(env, pv, n.Children[1])
+	case u.FUNC:
+		return callPathBuiltin(env, pv, n)
+	case u.TRY:
+		return tryPaths(env, pv, n)
+	case u.AS:
+		return bindPaths(env, pv, n)
+	case u.LOOKUP:
+		return lookupPaths(env, pv, n)
+	}
+
+	out, err := transform(env, pv.value, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(out.O) == 0 {
+		return nil, nil
+	}
+	return nil, invalidPath(out.O[0])
+}
+
+func invalidPath(o any) error {
+	return errorf("Invalid path expression with result %s", truncate(gqjson.NewJSON(o).Compact()))
+}
+
+func indexPaths(pv pathValue, c u.Cmd) ([]pathValue, error) {
+	prevs := []pathValue{pv}
+
+	for _, f := range c.Fields {
+		var newPrevs []pathValue
+
+		for _, prev := range prevs {
+			switch f.Kind {
+			case u.ROOT:
+				newPrevs = append(newPrevs, prev)
+			case u.ARRAY:
+				switch o := prev.value.(type) {
+				case []any:
+					for i, v := range o {
+						newPrevs = append(newPrevs, pathValue{appendPath(prev.path, int64(i)), v})
+					}
+				case *gqjson.Object:
+					for k, v := range o.All() {
+						newPrevs = append(newPrevs, pathValue{appendPath(prev.path, k), v})
+					}
+				default:
+					return nil, errorf("Cannot iterate over %s", describe(o))
+				}
+			case u.FIELD:
+				v, err := index(prev.value, f)
+				if err != nil {
+					return nil, err
+				}
+				newPrevs = append(newPrevs, pathValue{appendPath(prev.path, f.Name), v})
+			case u.IDX:
+				v, err := index(prev.value, f)
+				if err != nil {
+					return nil, err
+				}
+				newPrevs = append(newPrevs, pathValue{appendPath(prev.path, int64(f.Idx)), v})
+			}
+		}
+
+		prevs = newPrevs
+	}
+
+	return prevs, nil
+}
+
+func lookupPaths(env *Env, pv pathValue, n u.Node) ([]pathValue, error) {
+	var out []pathValue
+	keys, err := transform(env, pv.value, n.Children[1])
+	if err != nil {
+		return nil, err
+	}
+	terms, err := transformPaths(env, pv, n.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys.O {
+		for _, t := range terms {
+			f, err := keyField(t.value, k)
+			if err != nil {
+				return out, err
+			}
+			v, err := index(t.value, f)
+			if err != nil {
+				return out, err
+			}
+			key := k
+			if f.Kind == u.IDX {
+				key = int64(f.Idx)
+			}
+			out = append(out, pathValue{appendPath(t.path, key), v})
+		}
+	}
+	return out, nil
+}
+
+// recursePaths lists a value and all of its descendants, parents first.
+func recursePaths(pv pathValue) []pathValue {
+	out := []pathValue{pv}
+	switch o := pv.value.(type) {
+	case []any:
+		for i, v := range o {
+			out = append(out, recursePaths(pathValue{appendPath(pv.path, int64(i)), v})...)
+		}
+	case *gqjson.Object:
+		for k, v := range o.All() {
+			out = append(out, recursePaths(pathValue{appendPath(pv.path, k), v})...)
+		}
+	}
+	return out
+}
+
+func pathsOf(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	pvs, err := transformPaths(env, pathValue{path: []any{}, value: o}, n)
+	for _, pv := range pvs {
+		next.O = append(next.O, pv.path)
+	}
+	return next, err
+}
+
+func toPath(o any) ([]any, error) {
+	p, ok := o.([]any)
+	if !ok {
+		return nil, errorf("Path must be specified as an array")
+	}
+	return p, nil
+}
+
+func getpath(o any, p []any) (any, error) {
+	for _, k := range p {
+		if o == nil {
+			return nil, nil
+		}
+		switch k := k.(type) {
+		case string:
+			m, ok := o.(*gqjson.Object)
+			if !ok {
+				return nil, errorf("Cannot index %s with %q", typeName(o), k)
+			}
+			o, _ = m.Get(k)
+		default:
+			i, ok := toInt(k)
+			if !ok {
+				return nil, errorf("Cannot index %s with %s", typeName(o), typeName(k))
+			}
+			l, ok := o.([]any)
+			if !ok {
+				return nil, errorf("Cannot index %s with number", typeName(o))
+			}
+			if i < 0 {
+				i += len(l)
+			}
+			if i < 0 || i >= len(l) {
+				return nil, nil
+			}
+			o = l[i]
+		}
+	}
+	return o, nil
+}
+
+// setpath returns a copy of o with the value at p replaced by v. Only the
+// containers along the path are copied, so the input is never mutated and
+// unrelated subtrees stay shared.
+func setpath(o any, p []any, v any) (any, error) {
+	if len(p) == 0 {
+		return v, nil
+	}
+	switch k := p[0].(type) {
+	case string:
+		var m *gqjson.Object
+		switch o := o.(type) {
+		case nil:
+			m = gqjson.NewObject(1)
+		case *gqjson.Object:
+			m = o.Clone()
+		default:
+			return nil, errorf("Cannot index %s with %q", typeName(o), k)
+		}
+		prev, _ := m.Get(k)
+		child, err := setpath(prev, p[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		m.Set(k, child)
+		return m, nil
+	default:
+		i, ok := toInt(k)
+		if !ok {
+			return nil, errorf("Cannot index %s with %s", typeName(o), typeName(k))
+		}
+		var l []any
+		switch o := o.(type) {
+		case nil:
+			l = []any{}
+		case []any:
+			l = cloneList(o)
+		default:
+			return nil, errorf("Cannot index %s with number", typeName(o))
+		}
+		if i < 0 {
+			i += len(l)
+			if i < 0 {
+				return nil, errorf("Out of bounds negative array index")
+			}
+		}
+		for len(l) <= i {
+			l = append(l, nil)
+		}
+		child, err := setpath(l[i], p[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		l[i] = child
+		return l, nil
+	}
+}
+
+// delpaths removes every path from o. Paths are deleted from the last to the
+// first so that removing an array element does not shift the others.
+func delpaths(o any, ps [][]any) (any, error) {
+	sorted := make([][]any, len(ps))
+	copy(sorted, ps)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareValues(sorted[i], sorted[j]) > 0
+	})
+
+	var err error
+	for _, p := range sorted {
+		o, err = delpath(o, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func delpath(o any, p []any) (any, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	if o == nil {
+		return nil, nil
+	}
+	if len(p) > 1 {
+		child, err := getpath(o, p[:1])
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return o, nil
+		}
+		newChild, err := delpath(child, p[1:])
+		if err != nil {
+			return nil, err
+		}
+		return setpath(o, p[:1], newChild)
+	}
+
+	switch k := p[0].(type) {
+	case string:
+		m, ok := o.(*gqjson.Object)
+		if !ok {
+			return nil, errorf("Cannot delete field at object index of %s", typeName(o))
+		}
+		m = m.Clone()
+		m.Delete(k)
+		return m, nil
+	default:
+		i, ok := toInt(k)
+		l, isList := o.([]any)
+		if !ok || !isList {
+			return nil, errorf("Cannot delete field at index of %s", typeName(o))
+		}
+		if i < 0 {
+			i += len(l)
+		}
+		if i < 0 || i >= len(l) {
+			return o, nil
+		}
+		out := make([]any, 0, len(l)-1)
+		out = append(out, l[:i]...)
+		return append(out, l[i+1:]...), nil
+	}
+}
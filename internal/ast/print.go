@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/jmpargana/gq/internal/gqjson"
 	u "github.com/jmpargana/gq/internal/utils"
 )
 
@@ -38,6 +39,34 @@ func printCmd(c u.Cmd, ident int) string {
 		fmt.Fprintf(&s, "DICT:")
 	case u.PIPE:
 		fmt.Fprintf(&s, "PIPE:")
+	case u.COMMA:
+		fmt.Fprintf(&s, "COMMA:")
+	case u.LITERAL:
+		fmt.Fprintf(&s, "LITERAL: %s", gqjson.NewJSON(c.Literal).Compact())
+	case u.BINOP:
+		fmt.Fprintf(&s, "BINOP: %s", c.Ident)
+	case u.AND:
+		fmt.Fprintf(&s, "AND:")
+	case u.OR:
+		fmt.Fprintf(&s, "OR:")
+	case u.ALT:
+		fmt.Fprintf(&s, "ALT:")
+	case u.UPDATE:
+		fmt.Fprintf(&s, "UPDATE: %s", c.Ident)
+	case u.FUNC:
+		fmt.Fprintf(&s, "FUNC: %s", c.Ident)
+	case u.TRY:
+		fmt.Fprintf(&s, "TRY:")
+	case u.FORMAT:
+		fmt.Fprintf(&s, "FORMAT: @%s", c.Ident)
+	case u.VARIABLE:
+		fmt.Fprintf(&s, "VARIABLE: $%s", c.Ident)
+	case u.AS:
+		fmt.Fprintf(&s, "AS: $%s", c.Ident)
+	case u.LOOKUP:
+		fmt.Fprintf(&s, "LOOKUP:")
+	case u.REDUCE:
+		fmt.Fprintf(&s, "REDUCE: $%s", c.Ident)
 	case u.IDX:
 		fmt.Fprintf(&s, "IDX:")
 		for _, f := range c.Fields {
@@ -0,0 +1,158 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// access describes what an expression reads of its input, as paths into it.
+// needs are the paths whose whole values are used, while outs are the paths
+// the outputs are taken from, which callers either index further or use in
+// full. Computed outputs have no outs and put what they read in needs.
+type access struct {
+	needs, outs [][]any
+}
+
+// consume is the access of a value that is used in full.
+func (a access) consume() [][]any {
+	return append(append([][]any{}, a.needs...), a.outs...)
+}
+
+func (a access) union(b access) access {
+	return access{
+		needs: append(append([][]any{}, a.needs...), b.needs...),
+		outs:  append(append([][]any{}, a.outs...), b.outs...),
+	}
+}
+
+// under prefixes every path of paths with every path of prefixes.
+func under(prefixes, paths [][]any) [][]any {
+	var out [][]any
+	for _, pre := range prefixes {
+		for _, p := range paths {
+			out = append(out, append(append([]any{}, pre...), p...))
+		}
+	}
+	return out
+}
+
+var whole = [][]any{{}}
+
+// inputFree lists builtins that do not look at their input.
+var inputFree = map[string]bool{
+	"empty/0": true, "now/0": true, "env/0": true, "halt/0": true,
+	"input_filename/0": true, "input_line_number/0": true,
+}
+
+// analyze returns what n reads of its input.
+func analyze(n u.Node) access {
+	switch n.Value.Kind {
+	case u.PIPE:
+		l := analyze(n.Children[0])
+		r := analyze(n.Children[1])
+		return access{
+			needs: append(append([][]any{}, l.needs...), under(l.outs, r.needs)...),
+			outs:  under(l.outs, r.outs),
+		}
+	case u.COMMA, u.ALT:
+		l := analyze(n.Children[0])
+		r := analyze(n.Children[1])
+		return l.union(r)
+	case u.IDX:
+		var path []any
+		for _, f := range n.Value.Fields {
+			switch {
+			case f.Kind == u.FIELD:
+				path = append(path, f.Name)
+			case f.Kind == u.IDX && f.Idx >= 0:
+				path = append(path, f.Idx)
+			case f.Kind == u.IDX, f.Kind == u.ARRAY:
+				// negative indices depend on the length
+				path = append(path, gqjson.Each)
+			}
+		}
+		return access{outs: [][]any{path}}
+	case u.LITERAL, u.VARIABLE:
+		return access{}
+	case u.TRY:
+		// a handler runs on the error, not on the input
+		return analyze(n.Children[0])
+	case u.LOOKUP:
+		term := analyze(n.Children[0])
+		key := analyze(n.Children[1])
+		return access{
+			needs: append(append([][]any{}, term.needs...), key.consume()...),
+			outs:  under(term.outs, [][]any{{gqjson.Each}}),
+		}
+	case u.REDUCE:
+		// the update runs on the accumulator
+		return consumeAll(n.Children[:2])
+	case u.AS:
+		src := analyze(n.Children[0])
+		body := analyze(n.Children[1])
+		return access{needs: append(src.consume(), body.needs...), outs: body.outs}
+	case u.INDEXSTART, u.BINOP, u.AND, u.OR, u.FORMAT:
+		return consumeAll(n.Children)
+	case u.DICTSTART:
+		var values []u.Node
+		for _, c := range n.Children {
+			values = append(values, c.Children[0])
+		}
+		return consumeAll(values)
+	case u.FUNC:
+		name := fmt.Sprintf("%s/%d", n.Value.Ident, len(n.Children))
+		switch {
+		case name == "select/1":
+			cond := analyze(n.Children[0])
+			return access{needs: cond.consume(), outs: whole}
+		case inputFree[name]:
+			return access{}
+		}
+	}
+	// anything else may look at the whole input
+	return access{needs: whole}
+}
+
+// consumeAll is the access of expressions whose outputs are used in full.
+func consumeAll(ns []u.Node) access {
+	var out access
+	for _, c := range ns {
+		a := analyze(c)
+		out.needs = append(out.needs, a.consume()...)
+	}
+	return out
+}
+
+// readsInputs reports whether n calls input or inputs, whose values are
+// decoded like the input and must therefore be whole.
+func readsInputs(n u.Node) bool {
+	if n.Value.Kind == u.FUNC && len(n.Children) == 0 && (n.Value.Ident == "input" || n.Value.Ident == "inputs") {
+		return true
+	}
+	for _, c := range n.Children {
+		if readsInputs(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Projection returns the parts of its input that the program may read, so
+// that everything else can be skipped when decoding it. It is nil, meaning
+// the whole input, for programs that look at all of it, e.g. with .. or
+// keys, or that read further inputs with input or inputs.
+func Projection(n u.Node) *gqjson.Projection {
+	if readsInputs(n) {
+		return nil
+	}
+	a := analyze(n)
+	p := gqjson.NewProjection()
+	for _, path := range a.consume() {
+		if p = p.Include(path); p == nil {
+			return nil
+		}
+	}
+	return p
+}
@@ -0,0 +1,404 @@
+package ast
+
+import (
+	"container/list"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// regex is a compiled expression together with the jq flags that change how
+// it is applied rather than how it is compiled.
+type regex struct {
+	re         *regexp.Regexp
+	global     bool
+	skipEmpty  bool
+	groupNames []string
+}
+
+// regexCache keeps the most recently used expressions, so that patterns
+// taken from the input do not grow it without bound.
+var regexCache = newRegexLRU(64)
+
+// regexLRU is a cache of compiled expressions that drops the least recently
+// used one when full.
+type regexLRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type regexEntry struct {
+	key string
+	r   *regex
+}
+
+func newRegexLRU(size int) *regexLRU {
+	return &regexLRU{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *regexLRU) get(key string) (*regex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(regexEntry).r, true
+}
+
+func (c *regexLRU) put(key string, r *regex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(regexEntry{key: key, r: r})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(regexEntry).key)
+	}
+}
+
+// compileRegex translates jq's flag string to RE2. Go's regexp package uses
+// RE2 syntax instead of Oniguruma, so lookarounds, backreferences and
+// possessive quantifiers are not available.
+func compileRegex(expr, flags any) (*regex, error) {
+	s, ok := expr.(string)
+	if !ok {
+		return nil, errorf("%s cannot be matched, as it is not a string", describe(expr))
+	}
+	var fs string
+	switch f := flags.(type) {
+	case nil:
+	case string:
+		fs = f
+	default:
+		return nil, errorf("%s is not a string", describe(flags))
+	}
+
+	key := fs + "/" + s
+	if r, ok := regexCache.get(key); ok {
+		return r, nil
+	}
+
+	r := &regex{}
+	var mods string
+	longest := false
+	for _, f := range fs {
+		switch f {
+		case 'g':
+			r.global = true
+		case 'i':
+			mods += "i"
+		case 'x':
+			s = stripExtended(s)
+		case 'n':
+			r.skipEmpty = true
+		case 's', 'p':
+			mods += "s"
+		case 'l':
+			longest = true
+		default:
+			return nil, errorf("%s is not a valid modifier string", fs)
+		}
+	}
+	if mods != "" {
+		s = "(?" + mods + ")" + s
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, errorf("%s is not a valid regex: %v", expr, err)
+	}
+	if longest {
+		re.Longest()
+	}
+	r.re = re
+	r.groupNames = re.SubexpNames()
+	regexCache.put(key, r)
+	return r, nil
+}
+
+// stripExtended removes the whitespace and comments allowed by the x flag,
+// which RE2 does not support natively. Escaped characters and character
+// classes are kept as they are.
+func stripExtended(s string) string {
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			b.WriteByte(c)
+			i++
+			b.WriteByte(s[i])
+			continue
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// matches returns the byte offsets of every match of r in s, as returned by
+// FindAllStringSubmatchIndex.
+func (r *regex) matches(s string) [][]int {
+	n := 1
+	if r.global {
+		n = -1
+	}
+	all := r.re.FindAllStringSubmatchIndex(s, n)
+	if !r.skipEmpty {
+		return all
+	}
+	var out [][]int
+	for _, m := range all {
+		if m[1] > m[0] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// matchObject builds jq's representation of a match. Offsets and lengths are
+// counted in codepoints, and groups that did not participate in the match
+// have an offset of -1 and a null string.
+func (r *regex) matchObject(s string, m []int) *gqjson.Object {
+	captures := []any{}
+	for g := 1; g < len(m)/2; g++ {
+		var name any
+		if r.groupNames[g] != "" {
+			name = r.groupNames[g]
+		}
+		start, end := m[2*g], m[2*g+1]
+		if start < 0 {
+			captures = append(captures, gqjson.ObjectOf(
+				"offset", int64(-1), "length", int64(0), "string", nil, "name", name,
+			))
+			continue
+		}
+		captures = append(captures, gqjson.ObjectOf(
+			"offset", codepoints(s[:start]),
+			"length", codepoints(s[start:end]),
+			"string", s[start:end],
+			"name", name,
+		))
+	}
+	return gqjson.ObjectOf(
+		"offset", codepoints(s[:m[0]]),
+		"length", codepoints(s[m[0]:m[1]]),
+		"string", s[m[0]:m[1]],
+		"captures", captures,
+	)
+}
+
+// captureObject maps the names of the groups to the text they matched.
+func (r *regex) captureObject(s string, m []int) *gqjson.Object {
+	out := gqjson.NewObject(len(r.groupNames))
+	for g := 1; g < len(m)/2; g++ {
+		if r.groupNames[g] == "" {
+			continue
+		}
+		if m[2*g] < 0 {
+			out.Set(r.groupNames[g], nil)
+			continue
+		}
+		out.Set(r.groupNames[g], s[m[2*g]:m[2*g+1]])
+	}
+	return out
+}
+
+func codepoints(s string) int64 {
+	return int64(utf8.RuneCountInString(s))
+}
+
+// regexArgs splits the arguments of a regex builtin into the expression and
+// its flags. Like jq, the single argument form also accepts `[re, flags]`.
+func regexArgs(args []any) (any, any) {
+	if len(args) > 1 {
+		return args[0], args[1]
+	}
+	if l, ok := args[0].([]any); ok && len(l) > 0 {
+		if len(l) > 1 {
+			return l[0], l[1]
+		}
+		return l[0], nil
+	}
+	return args[0], nil
+}
+
+func matchInput(o any) (string, error) {
+	s, ok := o.(string)
+	if !ok {
+		return "", errorf("%s cannot be matched, as it is not a string", describe(o))
+	}
+	return s, nil
+}
+
+// regexBuiltin wraps f into a builtin whose arguments are the regex and the
+// optional flags, with extraFlags always added to the latter.
+func regexBuiltin(extraFlags string, f func(s string, r *regex) (stream.Stream, error)) builtin {
+	return func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+		next := stream.New()
+		err := eachArgs(env, o, args, func(vals []any) error {
+			s, err := matchInput(o)
+			if err != nil {
+				return err
+			}
+			expr, flags := regexArgs(vals)
+			if extraFlags != "" {
+				fs, _ := flags.(string)
+				flags = fs + extraFlags
+			}
+			r, err := compileRegex(expr, flags)
+			if err != nil {
+				return err
+			}
+			out, err := f(s, r)
+			next.O = append(next.O, out.O...)
+			return err
+		})
+		return next, err
+	}
+}
+
+func testRegex(s string, r *regex) (stream.Stream, error) {
+	return stream.NewS(len(r.matches(s)) > 0), nil
+}
+
+func matchRegex(s string, r *regex) (stream.Stream, error) {
+	next := stream.New()
+	for _, m := range r.matches(s) {
+		next.O = append(next.O, r.matchObject(s, m))
+	}
+	return next, nil
+}
+
+func captureRegex(s string, r *regex) (stream.Stream, error) {
+	next := stream.New()
+	for _, m := range r.matches(s) {
+		next.O = append(next.O, r.captureObject(s, m))
+	}
+	return next, nil
+}
+
+// scanRegex outputs the matched text, or the text of every group when the
+// expression has any.
+func scanRegex(s string, r *regex) (stream.Stream, error) {
+	next := stream.New()
+	for _, m := range r.matches(s) {
+		if len(m) == 2 {
+			next.O = append(next.O, s[m[0]:m[1]])
+			continue
+		}
+		groups := []any{}
+		for g := 1; g < len(m)/2; g++ {
+			if m[2*g] < 0 {
+				groups = append(groups, nil)
+				continue
+			}
+			groups = append(groups, s[m[2*g]:m[2*g+1]])
+		}
+		next.O = append(next.O, groups)
+	}
+	return next, nil
+}
+
+func splitRegex(s string, r *regex) []any {
+	out := []any{}
+	prev := 0
+	for _, m := range r.matches(s) {
+		out = append(out, s[prev:m[0]])
+		prev = m[1]
+	}
+	return append(out, s[prev:])
+}
+
+// subRegex replaces the matches of the regex with the outputs of repl, which
+// is evaluated with the object of named captures as input. Every combination
+// of replacement outputs yields one string.
+func subRegex(env *Env, s string, r *regex, repl u.Node) (stream.Stream, error) {
+	next := stream.New()
+	results := []any{""}
+	prev := 0
+	for _, m := range r.matches(s) {
+		reps, err := transform(env, r.captureObject(s, m), repl)
+		if err != nil {
+			return next, err
+		}
+		gap := s[prev:m[0]]
+		var nextResults []any
+		for _, res := range results {
+			for _, rep := range reps.O {
+				v, err := arithmetic("+", res.(string)+gap, rep)
+				if err != nil {
+					return next, err
+				}
+				nextResults = append(nextResults, v)
+			}
+		}
+		results = nextResults
+		prev = m[1]
+	}
+	for _, res := range results {
+		next.O = append(next.O, res.(string)+s[prev:])
+	}
+	return next, nil
+}
+
+// subBuiltin evaluates the regex and flag arguments of sub and gsub while
+// leaving the replacement, which runs once per match, unevaluated.
+func subBuiltin(extraFlags string) builtin {
+	return func(env *Env, o any, args []u.Node) (stream.Stream, error) {
+		repl := args[1]
+		rest := append([]u.Node{args[0]}, args[2:]...)
+		return regexBuiltin(extraFlags, func(s string, r *regex) (stream.Stream, error) {
+			return subRegex(env, s, r, repl)
+		})(env, o, rest)
+	}
+}
+
+func init() {
+	register(map[string]builtin{
+		"test/1":    regexBuiltin("", testRegex),
+		"test/2":    regexBuiltin("", testRegex),
+		"match/1":   regexBuiltin("", matchRegex),
+		"match/2":   regexBuiltin("", matchRegex),
+		"capture/1": regexBuiltin("", captureRegex),
+		"capture/2": regexBuiltin("", captureRegex),
+		"scan/1":    regexBuiltin("g", scanRegex),
+		"scan/2":    regexBuiltin("g", scanRegex),
+		"split/2": regexBuiltin("g", func(s string, r *regex) (stream.Stream, error) {
+			return stream.NewS(splitRegex(s, r)), nil
+		}),
+		"splits/1": regexBuiltin("g", func(s string, r *regex) (stream.Stream, error) {
+			return stream.Stream{O: splitRegex(s, r)}, nil
+		}),
+		"splits/2": regexBuiltin("g", func(s string, r *regex) (stream.Stream, error) {
+			return stream.Stream{O: splitRegex(s, r)}, nil
+		}),
+		"sub/2":  subBuiltin(""),
+		"sub/3":  subBuiltin(""),
+		"gsub/2": subBuiltin("g"),
+		"gsub/3": subBuiltin("g"),
+	})
+}
@@ -0,0 +1,145 @@
+package ast
+
+import (
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// streamEvents appends the --stream events of o, found at path, to out.
+// Containers that are not empty are closed by an event holding the path of
+// their last element.
+func streamEvents(o any, path []any, out []any) []any {
+	var last []any
+	switch o := o.(type) {
+	case []any:
+		for i, v := range o {
+			last = appendPath(path, int64(i))
+			out = streamEvents(v, last, out)
+		}
+	case *gqjson.Object:
+		for k, v := range o.All() {
+			last = appendPath(path, k)
+			out = streamEvents(v, last, out)
+		}
+	}
+	if last == nil {
+		return append(out, []any{path, o})
+	}
+	return append(out, []any{last})
+}
+
+// streamEvent splits a --stream event into its path and, for leaves, value.
+func streamEvent(ev any) (path []any, v any, leaf bool, err error) {
+	l, ok := ev.([]any)
+	if ok && (len(l) == 1 || len(l) == 2) {
+		if path, ok = l[0].([]any); ok {
+			if len(l) == 2 {
+				return path, l[1], true, nil
+			}
+			return path, nil, false, nil
+		}
+	}
+	return nil, nil, false, errorf("Invalid stream event %s", describe(ev))
+}
+
+// rebuilder rebuilds values from a stream of events, one event at a time.
+type rebuilder struct {
+	x    any
+	done bool
+}
+
+// add adds an event to the value being rebuilt, and returns that value once
+// it is complete: after a top-level leaf or once its top-level container is
+// closed.
+func (r *rebuilder) add(ev any) (out any, done bool, err error) {
+	if r.done {
+		r.x, r.done = nil, false
+	}
+	path, v, leaf, err := streamEvent(ev)
+	if err != nil {
+		return nil, false, err
+	}
+	if leaf {
+		r.done = len(path) == 0
+		if r.x, err = setpath(r.x, path, v); err != nil {
+			return nil, false, err
+		}
+	} else {
+		r.done = len(path) == 1
+	}
+	return r.x, r.done, nil
+}
+
+// streamDepth converts the depth of truncate_stream.
+func streamDepth(depth any) (int, error) {
+	n, ok := toInt(depth)
+	if !ok {
+		return 0, errorf("truncate_stream depth must be a number, not %s", typeName(depth))
+	}
+	return n, nil
+}
+
+// truncateEvents returns the emit function of truncate_stream, which drops
+// the first depth elements from the paths of events, along with the events
+// that are not deeper than that.
+func truncateEvents(depth int, emit func(any) error) func(any) error {
+	return func(ev any) error {
+		path, v, leaf, err := streamEvent(ev)
+		if err != nil {
+			return err
+		}
+		if len(path) <= depth {
+			return nil
+		}
+		if leaf {
+			return emit([]any{path[depth:], v})
+		}
+		return emit([]any{path[depth:]})
+	}
+}
+
+func init() {
+	register(map[string]builtin{
+		"tostream/0": func(_ *Env, o any, _ []u.Node) (stream.Stream, error) {
+			next := stream.New()
+			next.O = streamEvents(o, []any{}, nil)
+			return next, nil
+		},
+	})
+
+	// Events are handed on one at a time, so that fromstream(inputs) with
+	// --stream only holds the value being rebuilt.
+	registerGenerators(map[string]generator{
+		"fromstream/1": func(env *Env, o any, args []u.Node, emit func(any) error) error {
+			var r rebuilder
+			return each(env, o, args[0], func(ev any) error {
+				v, done, err := r.add(ev)
+				if err != nil || !done {
+					return err
+				}
+				return emit(v)
+			})
+		},
+		// jq's form, where the input is the depth and the events are
+		// generated from null.
+		"truncate_stream/1": func(env *Env, o any, args []u.Node, emit func(any) error) error {
+			depth, err := streamDepth(o)
+			if err != nil {
+				return err
+			}
+			return each(env, nil, args[0], truncateEvents(depth, emit))
+		},
+		// As with jq's $name parameters, the events are generated once for
+		// every depth.
+		"truncate_stream/2": func(env *Env, o any, args []u.Node, emit func(any) error) error {
+			return each(env, o, args[0], func(d any) error {
+				depth, err := streamDepth(d)
+				if err != nil {
+					return err
+				}
+				return each(env, o, args[1], truncateEvents(depth, emit))
+			})
+		},
+	})
+}
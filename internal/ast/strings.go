@@ -0,0 +1,189 @@
+package ast
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// stringBuiltin wraps a builtin that only accepts strings, failing with jq's
+// `<name> input must be a string` otherwise.
+func stringBuiltin(name string, f func(s string) (any, error)) builtin {
+	return simple(func(o any) (any, error) {
+		s, ok := o.(string)
+		if !ok {
+			return nil, errorf("%s input must be a string", name)
+		}
+		return f(s)
+	})
+}
+
+// trimAffix implements ltrimstr, rtrimstr and trimstr, which return their input
+// unchanged unless both it and the argument are strings.
+func trimAffix(trim func(s, affix string) string) builtin {
+	return withArgs(func(o any, args []any) (any, error) {
+		s, ok := o.(string)
+		affix, aok := args[0].(string)
+		if !ok || !aok {
+			return o, nil
+		}
+		return trim(s, affix), nil
+	})
+}
+
+func affixBuiltin(name string, has func(s, affix string) bool) builtin {
+	return withArgs(func(o any, args []any) (any, error) {
+		s, ok := o.(string)
+		affix, aok := args[0].(string)
+		if !ok || !aok {
+			return nil, errorf("%s() requires string inputs", name)
+		}
+		return has(s, affix), nil
+	})
+}
+
+func asciiCase(r func(rune) rune) func(s string) (any, error) {
+	return func(s string) (any, error) {
+		return strings.Map(func(c rune) rune {
+			if c > unicode.MaxASCII {
+				return c
+			}
+			return r(c)
+		}, s), nil
+	}
+}
+
+// length follows jq: codepoints for strings, elements for arrays and objects,
+// the absolute value for numbers and zero for null.
+func length(o any) (any, error) {
+	switch o := o.(type) {
+	case nil:
+		return int64(0), nil
+	case string:
+		return codepoints(o), nil
+	case []any:
+		return int64(len(o)), nil
+	case *gqjson.Object:
+		return int64(o.Len()), nil
+	}
+	if v, ok := absolute(o); ok {
+		return v, nil
+	}
+	return nil, errorf("%s has no length", describe(o))
+}
+
+func explode(s string) (any, error) {
+	out := make([]any, 0, len(s))
+	for _, r := range s {
+		out = append(out, int64(r))
+	}
+	return out, nil
+}
+
+func implode(o any) (any, error) {
+	l, ok := o.([]any)
+	if !ok {
+		return nil, errorf("implode input must be an array")
+	}
+	var b strings.Builder
+	for _, it := range l {
+		c, ok := it.(int64)
+		if !ok {
+			f, isFloat := it.(float64)
+			if !isFloat {
+				return nil, errorf("Unicode codepoint must be numeric")
+			}
+			c = int64(f)
+		}
+		if c < 0 || c > unicode.MaxRune || (c >= 0xd800 && c <= 0xdfff) {
+			return nil, errorf("Invalid codepoint literal %d", c)
+		}
+		b.WriteRune(rune(c))
+	}
+	return b.String(), nil
+}
+
+// join concatenates the elements with sep. Like jq, null becomes an empty
+// string and numbers and booleans are encoded as JSON.
+func join(o any, sep any) (any, error) {
+	var out any = ""
+	items, err := iterate(o)
+	if err != nil {
+		return nil, err
+	}
+	for i, it := range items {
+		if i > 0 {
+			if out, err = arithmetic("+", out, sep); err != nil {
+				return nil, err
+			}
+		}
+		switch it.(type) {
+		case nil:
+			it = ""
+		case bool, int64, float64:
+			it = toString(it)
+		}
+		if out, err = arithmetic("+", out, it); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func init() {
+	register(map[string]builtin{
+		"length/0": simple(length),
+		"utf8bytelength/0": simple(func(o any) (any, error) {
+			s, ok := o.(string)
+			if !ok {
+				return nil, errorf("%s only strings have UTF-8 byte length", describe(o))
+			}
+			return int64(len(s)), nil
+		}),
+		"ascii_downcase/0": stringBuiltin("ascii_downcase", asciiCase(unicode.ToLower)),
+		"ascii_upcase/0":   stringBuiltin("ascii_upcase", asciiCase(unicode.ToUpper)),
+		"ltrimstr/1":       trimAffix(strings.TrimPrefix),
+		"rtrimstr/1":       trimAffix(strings.TrimSuffix),
+		"trimstr/1": trimAffix(func(s, affix string) string {
+			return strings.TrimSuffix(strings.TrimPrefix(s, affix), affix)
+		}),
+		"trim/0": stringBuiltin("trim", func(s string) (any, error) {
+			return strings.TrimSpace(s), nil
+		}),
+		"ltrim/0": stringBuiltin("trim", func(s string) (any, error) {
+			return strings.TrimLeftFunc(s, unicode.IsSpace), nil
+		}),
+		"rtrim/0": stringBuiltin("trim", func(s string) (any, error) {
+			return strings.TrimRightFunc(s, unicode.IsSpace), nil
+		}),
+		"startswith/1": affixBuiltin("startswith", strings.HasPrefix),
+		"endswith/1":   affixBuiltin("endswith", strings.HasSuffix),
+		"split/1": withArgs(func(o any, args []any) (any, error) {
+			s, ok := o.(string)
+			sep, sok := args[0].(string)
+			if !ok || !sok {
+				return nil, errorf("split input and separator must be strings")
+			}
+			return splitString(s, sep), nil
+		}),
+		"join/1": withArgs(func(o any, args []any) (any, error) {
+			return join(o, args[0])
+		}),
+		"explode/0": stringBuiltin("explode", explode),
+		"implode/0": simple(implode),
+		"ascii/0": simple(func(o any) (any, error) {
+			c, ok := toInt(o)
+			if !ok || c < 0 || c > unicode.MaxASCII {
+				return nil, errorf("ascii input must be a codepoint between 0 and 127")
+			}
+			return string(rune(c)), nil
+		}),
+		"tojson/0": simple(func(o any) (any, error) {
+			return gqjson.NewJSON(o).Compact(), nil
+		}),
+		"tostring/0": simple(func(o any) (any, error) {
+			return toString(o), nil
+		}),
+	})
+}
@@ -0,0 +1,92 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// updateValue implements the assignment operators. The left hand side is
+// always a path expression evaluated against the input:
+//
+//	a = b    sets every path of a to each output of b (evaluated on .)
+//	a |= f   replaces the value at each path with the first output of f
+//	         applied to it, deleting the path when f produces nothing
+//	a op= b  is a |= . op $x for each output $x of b (evaluated on .)
+//	a //= b  is a |= . // $x for each output $x of b (evaluated on .)
+func updateValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	lhs, rhs := n.Children[0], n.Children[1]
+
+	pvs, err := transformPaths(env, pathValue{path: []any{}, value: o}, lhs)
+	if err != nil {
+		return next, err
+	}
+
+	if n.Value.Ident == "|=" {
+		out, err := modify(o, pvs, func(v any) (stream.Stream, error) {
+			return transform(env, v, rhs)
+		})
+		if err != nil {
+			return next, err
+		}
+		next.O = append(next.O, out)
+		return next, nil
+	}
+
+	values, err := transform(env, o, rhs)
+	if err != nil {
+		return next, err
+	}
+
+	op := strings.TrimSuffix(n.Value.Ident, "=")
+	for _, x := range values.O {
+		out, err := modify(o, pvs, func(v any) (stream.Stream, error) {
+			switch op {
+			case "":
+				return stream.NewS(x), nil
+			case "//":
+				if isTruthy(v) {
+					return stream.NewS(v), nil
+				}
+				return stream.NewS(x), nil
+			}
+			res, err := arithmetic(op, v, x)
+			if err != nil {
+				return stream.New(), err
+			}
+			return stream.NewS(res), nil
+		})
+		if err != nil {
+			return next, err
+		}
+		next.O = append(next.O, out)
+	}
+	return next, nil
+}
+
+// modify rewrites the value at every path with the first output of f. Paths
+// for which f yields nothing are deleted once all the others were updated.
+func modify(o any, pvs []pathValue, f func(any) (stream.Stream, error)) (any, error) {
+	var dels [][]any
+	for _, pv := range pvs {
+		cur, err := getpath(o, pv.path)
+		if err != nil {
+			return nil, err
+		}
+		res, err := f(cur)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.O) == 0 {
+			dels = append(dels, pv.path)
+			continue
+		}
+		o, err = setpath(o, pv.path, res.O[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return delpaths(o, dels)
+}
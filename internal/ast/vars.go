@@ -0,0 +1,184 @@
+package ast
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/stream"
+	u "github.com/jmpargana/gq/internal/utils"
+)
+
+// Env is what a program is evaluated with: the values of its variables and
+// where the input builtins read from. Binding a variable extends it without
+// changing it, so that an Env can be shared by everything evaluated in its
+// scope. A nil Env has no variables and no inputs.
+type Env struct {
+	vars   *binding
+	inputs Inputs
+}
+
+// binding is a variable and the bindings of the enclosing scopes, innermost
+// first, so that inner variables shadow outer ones.
+type binding struct {
+	name  string
+	value any
+	outer *binding
+}
+
+// bind returns env extended with $name set to v.
+func (env *Env) bind(name string, v any) *Env {
+	out := &Env{vars: &binding{name: name, value: v}}
+	if env != nil {
+		out.vars.outer = env.vars
+		out.inputs = env.inputs
+	}
+	return out
+}
+
+// lookup returns the value of $name.
+func (env *Env) lookup(name string) (any, bool) {
+	if env == nil {
+		return nil, false
+	}
+	for b := env.vars; b != nil; b = b.outer {
+		if b.name == name {
+			return b.value, true
+		}
+	}
+	return nil, false
+}
+
+// Bind returns the Env the program runs in, holding the values of
+// predefined variables, such as the ones given with --arg. $ENV and $ARGS
+// are always defined. Variables that are neither predefined nor bound with
+// `as` are reported the way jq does at compile time.
+func Bind(n u.Node, vars map[string]any) (*Env, error) {
+	env := &Env{}
+	env = env.bind("ENV", environ())
+	env = env.bind("ARGS", gqjson.ObjectOf("positional", []any{}, "named", gqjson.NewObject(0)))
+	for k, v := range vars {
+		env = env.bind(k, v)
+	}
+	return env, checkVars(n, env, nil)
+}
+
+// checkVars reports the first free variable of n that env does not define.
+// Variables in bound are bound by an enclosing `as`.
+func checkVars(n u.Node, env *Env, bound map[string]bool) error {
+	switch n.Value.Kind {
+	case u.VARIABLE:
+		if _, ok := env.lookup(n.Value.Ident); !ok && !bound[n.Value.Ident] {
+			return errorf("$%s is not defined", n.Value.Ident)
+		}
+		return nil
+	case u.AS, u.REDUCE:
+		// The variable is only bound in the last child, the body.
+		inner := map[string]bool{n.Value.Ident: true}
+		for k := range bound {
+			inner[k] = true
+		}
+		last := len(n.Children) - 1
+		for i, c := range n.Children {
+			b := bound
+			if i == last {
+				b = inner
+			}
+			if err := checkVars(c, env, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, c := range n.Children {
+		if err := checkVars(c, env, bound); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindValue evaluates `src as $name | body`: body runs once for every output
+// of src, with $name bound to that output.
+func bindValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	vals, err := transform(env, o, n.Children[0])
+	if err != nil {
+		return next, err
+	}
+	for _, v := range vals.O {
+		out, err := transform(env.bind(n.Value.Ident, v), o, n.Children[1])
+		next.O = append(next.O, out.O...)
+		if err != nil {
+			return next, err
+		}
+	}
+	return next, nil
+}
+
+// bindPaths is the path tracking variant of bindValue. The bound values are
+// plain values, only the body contributes to the paths.
+func bindPaths(env *Env, pv pathValue, n u.Node) ([]pathValue, error) {
+	var out []pathValue
+	vals, err := transform(env, pv.value, n.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vals.O {
+		pvs, err := transformPaths(env.bind(n.Value.Ident, v), pv, n.Children[1])
+		out = append(out, pvs...)
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// reduceValue evaluates `reduce source as $name (init; update)`. update runs
+// on the accumulator once for every output of source, and its last output
+// becomes the new accumulator, or null when it has none, as in jq 1.7. Like
+// in jq, source runs once for every init, and its outputs are not collected,
+// so that `reduce inputs as $x` holds a single input at a time.
+func reduceValue(env *Env, o any, n u.Node) (stream.Stream, error) {
+	next := stream.New()
+	inits, err := transform(env, o, n.Children[1])
+	if err != nil {
+		return next, err
+	}
+	for _, acc := range inits.O {
+		err := each(env, o, n.Children[0], func(v any) error {
+			out, err := transform(env.bind(n.Value.Ident, v), acc, n.Children[2])
+			if err != nil {
+				return err
+			}
+			acc = nil
+			if len(out.O) > 0 {
+				acc = out.O[len(out.O)-1]
+			}
+			return nil
+		})
+		if err != nil {
+			return next, err
+		}
+		next.O = append(next.O, acc)
+	}
+	return next, nil
+}
+
+// environ returns the environment of the process as an object, like $ENV.
+func environ() *gqjson.Object {
+	env := gqjson.NewObject(0)
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env.Set(k, v)
+	}
+	return env
+}
+
+func init() {
+	register(map[string]builtin{
+		"env/0": simple(func(_ any) (any, error) {
+			return environ(), nil
+		}),
+	})
+}
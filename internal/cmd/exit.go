@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmpargana/gq/internal/ast"
+	"github.com/jmpargana/gq/internal/gqjson"
+	u "github.com/jmpargana/gq/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// Exit statuses, the same as jq's.
+const (
+	exitFalsy    = 1
+	exitUsage    = 2
+	exitCompile  = 3
+	exitNoOutput = 4
+	exitRuntime  = 5
+)
+
+// ExitError makes gq exit with Code. Err is printed like any other error;
+// without it the error was reported already.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status for an error returned by RootCmd. Errors
+// without a code are about how gq was invoked.
+func ExitCode(err error) int {
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	return exitUsage
+}
+
+// runner runs the program on every input and keeps track of what decides the
+// exit status.
+type runner struct {
+	cmd     *cobra.Command
+	program u.Node
+	env     *ast.Env
+	opts    gqjson.Options
+	format  string
+	// rendered holds the outputs of formats that write them all at once
+	rendered []any
+	outputs  int
+	last     any
+	failed   bool
+	halt     *ast.Halt
+}
+
+// process runs the program on a single input and prints its outputs. Errors
+// are reported and, like in jq, the next input is still processed.
+func (r *runner) process(o any) {
+	err := ast.TransformEach(r.env, o, r.program, func(out any) {
+		r.print(out)
+		r.outputs++
+		r.last = out
+	})
+	if err == nil || errors.As(err, &r.halt) {
+		return
+	}
+	r.cmd.PrintErrln("Error:", err)
+	r.failed = true
+}
+
+// print writes a single output in the output format, with the separator of
+// the format between outputs.
+func (r *runner) print(out any) {
+	c, ok := codecs[r.format]
+	if !ok {
+		fmt.Print(gqjson.NewJSON(out).Format(r.opts))
+		return
+	}
+	if c.render != nil {
+		r.rendered = append(r.rendered, out)
+		return
+	}
+	s, err := c.format(out)
+	if err != nil {
+		r.cmd.PrintErrln("Error:", err)
+		r.failed = true
+		return
+	}
+	if r.outputs > 0 {
+		fmt.Print(c.separator)
+	}
+	fmt.Print(s)
+}
+
+// flush writes the outputs of formats that need all of them, such as tables.
+func (r *runner) flush() {
+	c, ok := codecs[r.format]
+	if !ok || c.render == nil {
+		return
+	}
+	s, err := c.render(r.rendered)
+	if err != nil {
+		r.cmd.PrintErrln("Error:", err)
+		r.failed = true
+		return
+	}
+	fmt.Print(s)
+}
+
+// exit returns the error gq exits with, if any. halt_error prints its input:
+// strings as they are, other values as JSON.
+func (r *runner) exit(exitStatus bool) error {
+	if r.halt != nil {
+		if r.halt.HasValue {
+			if s, ok := r.halt.Value.(string); ok {
+				r.cmd.PrintErr(s)
+			} else {
+				r.cmd.PrintErrln(gqjson.NewJSON(r.halt.Value).Compact())
+			}
+		}
+		if r.halt.Code == 0 {
+			return nil
+		}
+		return &ExitError{Code: r.halt.Code}
+	}
+	if r.failed {
+		return &ExitError{Code: exitRuntime}
+	}
+	if exitStatus {
+		if r.outputs == 0 {
+			return &ExitError{Code: exitNoOutput}
+		}
+		if r.last == nil || r.last == false {
+			return &ExitError{Code: exitFalsy}
+		}
+	}
+	return nil
+}
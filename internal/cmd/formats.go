@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqcbor"
+	"github.com/jmpargana/gq/internal/gqcsv"
+	"github.com/jmpargana/gq/internal/gqmsgpack"
+	"github.com/jmpargana/gq/internal/gqtable"
+	"github.com/jmpargana/gq/internal/gqtoml"
+	"github.com/jmpargana/gq/internal/gqxml"
+	"github.com/jmpargana/gq/internal/gqyaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// formats lists what inputs can be read from and outputs written in.
+var formats = []string{"json", "yaml", "toml", "csv", "tsv", "xml", "msgpack", "cbor", "table", "markdown"}
+
+// decoder reads the values of an input one at a time, returning io.EOF after
+// the last one.
+type decoder interface {
+	Next() (any, error)
+}
+
+// codec reads and writes a format other than JSON, which gq handles itself.
+// Outputs are written one at a time with format, or all at once with render
+// for formats such as tables that need every output first. A codec without
+// a decoder can only be written, and one without either can only be read.
+type codec struct {
+	decoder func(r io.Reader, mode inputMode) decoder
+	format  func(v any) (string, error)
+	// separator is printed between two outputs
+	separator string
+	render    func(outputs []any) (string, error)
+}
+
+var codecs = map[string]codec{
+	"yaml": {
+		decoder:   func(r io.Reader, _ inputMode) decoder { return gqyaml.NewDecoder(r) },
+		format:    gqyaml.Format,
+		separator: "---\n",
+	},
+	// TOML has no separator, so several outputs are not a single document
+	"toml": {
+		decoder:   func(r io.Reader, _ inputMode) decoder { return gqtoml.NewDecoder(r) },
+		format:    gqtoml.Format,
+		separator: "\n",
+	},
+	"csv": {decoder: csvDecoder, render: tableRenderer(func(t *gqtable.Table) (string, error) {
+		return t.CSV()
+	})},
+	"tsv": {decoder: csvDecoder, render: tableRenderer(func(t *gqtable.Table) (string, error) {
+		return t.TSV(), nil
+	})},
+	"xml": {decoder: func(r io.Reader, mode inputMode) decoder { return gqxml.NewDecoder(r, mode.xml) }},
+	// binary values delimit themselves
+	"msgpack": {
+		decoder: func(r io.Reader, _ inputMode) decoder { return gqmsgpack.NewDecoder(r) },
+		format:  gqmsgpack.Format,
+	},
+	"cbor": {
+		decoder: func(r io.Reader, _ inputMode) decoder { return gqcbor.NewDecoder(r) },
+		format:  gqcbor.Format,
+	},
+	"table": {render: tableRenderer(func(t *gqtable.Table) (string, error) {
+		return t.Text(), nil
+	})},
+	"markdown": {render: tableRenderer(func(t *gqtable.Table) (string, error) {
+		return t.Markdown(), nil
+	})},
+}
+
+// tableRenderer returns a render func writing the outputs as a table.
+func tableRenderer(write func(t *gqtable.Table) (string, error)) func([]any) (string, error) {
+	return func(outputs []any) (string, error) {
+		t, err := gqtable.New(outputs)
+		if err != nil {
+			return "", err
+		}
+		return write(t)
+	}
+}
+
+func csvDecoder(r io.Reader, mode inputMode) decoder {
+	return gqcsv.NewDecoder(r, mode.csv)
+}
+
+// dataFormats returns the formats given with --input-format and
+// --output-format.
+func dataFormats(flags *pflag.FlagSet) (in, out string, err error) {
+	in, _ = flags.GetString("input-format")
+	out, _ = flags.GetString("output-format")
+	for _, f := range []string{in, out} {
+		if !slices.Contains(formats, f) {
+			return "", "", fmt.Errorf("unknown format %q, expected one of %s", f, strings.Join(formats, ", "))
+		}
+	}
+	if c, ok := codecs[in]; ok && c.decoder == nil {
+		return "", "", fmt.Errorf("%s can only be an output format", in)
+	}
+	if c, ok := codecs[out]; ok && c.format == nil && c.render == nil {
+		return "", "", fmt.Errorf("%s can only be an input format", out)
+	}
+	seq, _ := flags.GetBool("seq")
+	stream, _ := flags.GetBool("stream")
+	streamErrors, _ := flags.GetBool("stream-errors")
+	if in != "json" && (seq || stream || streamErrors) {
+		return "", "", fmt.Errorf("--seq and --stream only read JSON")
+	}
+	return in, out, nil
+}
+
+// csvOptions returns how csv and tsv inputs are read, given with --no-header,
+// --delimiter, --quoting and --infer-types. Those flags are an error with
+// other input formats.
+func csvOptions(flags *pflag.FlagSet, format string) (gqcsv.Options, error) {
+	opts := gqcsv.Options{Delimiter: ',', Header: true, Quoting: gqcsv.Strict}
+	if format == "tsv" {
+		opts.Delimiter, opts.Quoting = '\t', gqcsv.None
+	}
+	if format != "csv" && format != "tsv" {
+		for _, name := range []string{"no-header", "delimiter", "quoting", "infer-types"} {
+			if flags.Changed(name) {
+				return opts, fmt.Errorf("--%s only applies to csv and tsv input", name)
+			}
+		}
+		return opts, nil
+	}
+
+	noHeader, _ := flags.GetBool("no-header")
+	opts.Header = !noHeader
+	opts.InferTypes, _ = flags.GetBool("infer-types")
+	if flags.Changed("delimiter") {
+		delim, _ := flags.GetString("delimiter")
+		if delim == `\t` {
+			delim = "\t"
+		}
+		r := []rune(delim)
+		if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' {
+			return opts, fmt.Errorf("invalid delimiter %q, expected a single character other than a quote or newline", delim)
+		}
+		opts.Delimiter = r[0]
+	}
+	if flags.Changed("quoting") {
+		quoting, _ := flags.GetString("quoting")
+		q, err := gqcsv.ParseQuoting(quoting)
+		if err != nil {
+			return opts, err
+		}
+		opts.Quoting = q
+	}
+	return opts, nil
+}
+
+// xmlOptions returns how xml inputs are read, given with
+// --xml-strip-namespaces.
+func xmlOptions(flags *pflag.FlagSet, format string) (gqxml.Options, error) {
+	var opts gqxml.Options
+	if format != "xml" && flags.Changed("xml-strip-namespaces") {
+		return opts, fmt.Errorf("--xml-strip-namespaces only applies to xml input")
+	}
+	opts.StripNamespaces, _ = flags.GetBool("xml-strip-namespaces")
+	return opts, nil
+}
+
+// formatCommand returns `gq <format>`, which is gq reading and writing that
+// format unless told otherwise.
+func formatCommand(format string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   format + " <program> [files...]",
+		Short: fmt.Sprintf("Runs gq on %s, reading and writing it by default", strings.ToUpper(format)),
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range []string{"input-format", "output-format"} {
+				if !cmd.Flags().Changed(name) {
+					cmd.Flags().Set(name, format)
+				}
+			}
+			return RootCmd.RunE(cmd, args)
+		},
+	}
+	c.Flags().AddFlagSet(RootCmd.Flags())
+	return c
+}
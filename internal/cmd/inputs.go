@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqcsv"
+	json "github.com/jmpargana/gq/internal/gqjson"
+	"github.com/jmpargana/gq/internal/gqxml"
+)
+
+// stdinName is how standard input is referred to in errors.
+const stdinName = "<stdin>"
+
+// inputMode selects how inputs are read. format is one of formats. In raw mode
+// every line of text is an input string, with slurp the whole stream is a
+// single input and seq reads RFC 7464 JSON text sequences. In stream mode
+// every input is a [path, leaf] event, and with streamErrors invalid JSON is
+// reported as an [error, path] event instead of failing.
+type inputMode struct {
+	format string
+	// csv is how csv and tsv inputs are read
+	csv gqcsv.Options
+	// xml is how xml inputs are read
+	xml          gqxml.Options
+	raw          bool
+	slurp        bool
+	seq          bool
+	stream       bool
+	streamErrors bool
+}
+
+// inputs reads the JSON values of the input files in order, as a single
+// stream. Standard input is read when no files are given.
+type inputs struct {
+	files []string
+	inputMode
+	// warnings receives the records skipped in seq mode and the files that
+	// could not be opened
+	warnings io.Writer
+	// openFailed is set once a file could not be opened
+	openFailed bool
+	// projection selects the parts of each value that are decoded
+	projection *json.Projection
+	// slurped is set once the single slurped input was returned
+	slurped bool
+	// name is the file currently being read
+	name   string
+	stdin  bool
+	f      *os.File
+	lines  *lineReader
+	r      *bufio.Reader
+	events *json.StreamParser
+	// decoder reads the current file in formats other than JSON
+	decoder decoder
+}
+
+func newInputs(files []string, mode inputMode, warnings io.Writer) *inputs {
+	in := &inputs{files: files, inputMode: mode, warnings: warnings}
+	if len(files) == 0 {
+		in.name, in.stdin = stdinName, true
+		in.setReader(os.Stdin)
+	}
+	return in
+}
+
+// Next returns the next input value, or io.EOF once every input has been
+// read. Parse errors name the file they come from.
+func (in *inputs) Next() (any, error) {
+	if in.slurp {
+		if in.slurped {
+			return nil, io.EOF
+		}
+		in.slurped = true
+		return in.readAll()
+	}
+	return in.next()
+}
+
+// Filename returns the name of the file being read, or nil for stdin.
+func (in *inputs) Filename() any {
+	if in.stdin || in.name == "" {
+		return nil
+	}
+	return in.name
+}
+
+// LineNumber returns how many lines of the current file were read so far.
+func (in *inputs) LineNumber() int64 {
+	if in.lines == nil {
+		return 0
+	}
+	return in.lines.n
+}
+
+func (in *inputs) next() (any, error) {
+	for {
+		if err := in.advance(); err != nil {
+			return nil, err
+		}
+
+		if in.raw {
+			line, err := in.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("failed reading %s: %w", in.name, err)
+			}
+			if line == "" {
+				in.close()
+				continue
+			}
+			return strings.TrimSuffix(line, "\n"), nil
+		}
+
+		if c, ok := codecs[in.format]; ok {
+			if in.decoder == nil {
+				in.decoder = c.decoder(in.r, in.inputMode)
+			}
+			v, err := in.decoder.Next()
+			if err == io.EOF {
+				in.close()
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed parsing %s: %w", in.name, err)
+			}
+			return v, nil
+		}
+
+		if in.stream {
+			ev, err := in.events.Next()
+			if err == io.EOF {
+				in.close()
+				continue
+			}
+			if err != nil && in.streamErrors {
+				// the rest of the file cannot be parsed reliably
+				path := in.events.Path()
+				in.close()
+				return []any{fmt.Sprintf("%s: %v", in.name, err), path}, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed parsing %s: %w", in.name, err)
+			}
+			return ev, nil
+		}
+
+		parse := json.ParseValue
+		if in.projection != nil {
+			parse = func(r *bufio.Reader) (any, error) {
+				return json.ParseProjectedValue(r, in.projection)
+			}
+		}
+		if in.seq {
+			parse = json.ParseSeqValue
+		}
+		v, err := parse(in.r)
+		if err == io.EOF {
+			in.close()
+			continue
+		}
+		var skipped *json.SeqError
+		if errors.As(err, &skipped) {
+			fmt.Fprintf(in.warnings, "%s: %v\n", in.name, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing %s: %w", in.name, err)
+		}
+		return v, nil
+	}
+}
+
+// readAll reads all remaining inputs at once: the values collected into an
+// array, or in raw mode the whole text as a single string.
+func (in *inputs) readAll() (any, error) {
+	if in.raw {
+		var sb strings.Builder
+		for {
+			if err := in.advance(); err == io.EOF {
+				return sb.String(), nil
+			} else if err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(&sb, in.r); err != nil {
+				return nil, fmt.Errorf("failed reading %s: %w", in.name, err)
+			}
+			in.close()
+		}
+	}
+
+	out := []any{}
+	for {
+		v, err := in.next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+}
+
+// advance opens the next file once the current one is exhausted. Files that
+// cannot be opened are reported and skipped. It returns io.EOF when there are
+// no files left.
+func (in *inputs) advance() error {
+	if in.r != nil {
+		return nil
+	}
+	for len(in.files) > 0 {
+		name := in.files[0]
+		in.files = in.files[1:]
+		f, err := os.Open(name)
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		if err != nil {
+			// like jq, report it and go on with the other files
+			fmt.Fprintf(in.warnings, "Error: could not open %s: %v\n", name, err)
+			in.openFailed = true
+			continue
+		}
+		in.name, in.f = name, f
+		in.setReader(f)
+		return nil
+	}
+	return io.EOF
+}
+
+func (in *inputs) setReader(r io.Reader) {
+	in.lines = &lineReader{r: bufio.NewReader(r)}
+	in.r = bufio.NewReader(in.lines)
+	in.events = json.NewStreamParser(in.r)
+}
+
+// close releases the current file, if any. The line count is kept for
+// input_line_number until the next file is opened.
+func (in *inputs) close() {
+	if in.f != nil {
+		in.f.Close()
+	}
+	in.f, in.r, in.decoder = nil, nil, nil
+}
+
+// lineReader hands out at most one line per Read, like the fgets loop of jq,
+// so that the count of lines read follows the position of the parser.
+type lineReader struct {
+	r       *bufio.Reader
+	pending []byte
+	n       int64
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	if len(l.pending) == 0 {
+		line, err := l.r.ReadSlice('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		if line[len(line)-1] == '\n' {
+			l.n++
+		}
+		l.pending = line
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
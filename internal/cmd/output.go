@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"github.com/spf13/cobra"
+)
+
+// outputOptions returns how outputs are printed according to the flags and
+// the environment.
+func outputOptions(cmd *cobra.Command) gqjson.Options {
+	var opts gqjson.Options
+	opts.ASCII, _ = cmd.Flags().GetBool("ascii-output")
+	opts.Seq, _ = cmd.Flags().GetBool("seq")
+	if useColor(cmd) {
+		colors := gqjson.DefaultColors
+		if spec := os.Getenv("GQ_COLORS"); spec != "" {
+			c, err := gqjson.ParseColors(spec)
+			if err != nil {
+				cmd.PrintErrln("Failed to set $GQ_COLORS:", err)
+			}
+			colors = c
+		}
+		opts.Colors = &colors
+	}
+	return opts
+}
+
+// useColor decides on colored output: -M wins over -C, and without either
+// colors are used when stdout is a terminal and NO_COLOR is not set.
+func useColor(cmd *cobra.Command) bool {
+	if mono, _ := cmd.Flags().GetBool("monochrome-output"); mono {
+		return false
+	}
+	if color, _ := cmd.Flags().GetBool("color-output"); color {
+		return true
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
@@ -1,16 +1,16 @@
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/jmpargana/gq/internal/ast"
-	json "github.com/jmpargana/gq/internal/gqjson"
 	"github.com/jmpargana/gq/internal/lexer"
 	"github.com/jmpargana/gq/internal/parser"
-	"github.com/jmpargana/gq/internal/stream"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var RootCmd = &cobra.Command{
@@ -28,51 +28,174 @@ List of battle tested features:
 	- array creation
 	- dictionary creation
 	- nested piping
+	- arithmetic, comparisons and alternatives (//)
+	- update-assignment (=, |=, +=, -=, *=, /=, %=, //=)
+	- path expressions: path, paths, getpath, setpath, delpaths, del
+	- error handling: try/catch, error, the ? operator and $__loc__
+	- string interpolation ("\(.a)") and @formats (@csv, @tsv, @json, @html, @uri, @sh, @base64)
+	- regular expressions: test, match, capture, scan, split, splits, sub, gsub
+	- string functions: length, ascii_downcase, ltrimstr, trim, startswith, split, join, explode, tojson, ...
+	- dates: now, todate, fromdate, gmtime, localtime, mktime, strftime, strptime, ...
+	- math: floor, ceil, round, sqrt, pow, log, exp, abs, isnan, infinite, tonumber, ...
+	- programs read from a file with -f, with # comments
+	- input files given after the program, or standard input
+	- null input (-n), slurp (-s) and raw input (-R) modes
+	- input, inputs, input_filename, input_line_number and reduce
+	- exit status with -e, halt and halt_error
+	- colored output (-C, -M, NO_COLOR and GQ_COLORS) and ASCII output (-a)
+	- RFC 7464 JSON text sequences (--seq)
+	- YAML input and output (--input-format, --output-format and gq yaml)
+	- TOML input and output (--input-format, --output-format and gq toml)
+	- CSV and TSV input, with rows read as objects named after the header
+	- CSV, TSV, aligned text and Markdown tables as output (--output-format)
+	- XML input, with attributes as @name and text as #text
+	- MessagePack and CBOR input and output
+	- decoding only the parts of the input that the program reads
+	- streaming large inputs as [path, leaf] events (--stream), tostream, fromstream and truncate_stream
+	- variables: . as $x, .[$k], --arg, --argjson, --slurpfile, --rawfile, --args, --jsonargs, $ARGS, $ENV and env
 	
 Additionally, you can also view the AST of your jqlang expression.
 `,
 	Args: cobra.ArbitraryArgs,
-	RunE: func(cmd *cobra.Command, _ []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		var exit *ExitError
+		if errors.As(err, &exit) && exit.Err == nil {
+			// everything was reported already
+			cmd.SilenceErrors = true
+		}
+		return err
+	},
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	// Named variables come first, so that their errors are not taken for a
+	// missing program.
+	named, err := namedVars(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	program, rest, err := readProgram(cmd.Flags(), args)
+	if err != nil {
+		return err
+	}
+
+	// The arguments after the program are input files, unless --args or
+	// --jsonargs make them positional arguments.
+	var files, positional []string
+	strArgs, _ := cmd.Flags().GetBool("args")
+	jsonArgs, _ := cmd.Flags().GetBool("jsonargs")
+	if strArgs || jsonArgs {
+		positional = rest
+	} else {
+		files = rest
+	}
+	vars, err := programVars(cmd.Flags(), named, positional)
+	if err != nil {
+		return err
+	}
+	inFormat, outFormat, err := dataFormats(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	csvOpts, err := csvOptions(cmd.Flags(), inFormat)
+	if err != nil {
+		return err
+	}
+	xmlOpts, err := xmlOptions(cmd.Flags(), inFormat)
+	if err != nil {
+		return err
+	}
+
+	nullInput, _ := cmd.Flags().GetBool("null-input")
+	if len(files) == 0 && !nullInput {
 		if err := requireStdin(); err != nil {
 			return err
 		}
+	}
+
+	// Errors past this point are not about how gq was invoked.
+	cmd.SilenceUsage = true
 
-		if len(os.Args) < 2 {
-			return fmt.Errorf("no program provided")
+	tokens := lexer.Lex(program)
+	for _, tok := range tokens {
+		if tok.Kind == lexer.ILLEGAL {
+			return &ExitError{Code: exitCompile, Err: fmt.Errorf("illegal token found: %v", tok.Value)}
 		}
+	}
 
-		r := bufio.NewReader(os.Stdin)
+	p := parser.NewParser(tokens)
 
-		// TODO: replace with cobra args
-		tokens := lexer.Lex(os.Args[1])
-		for _, tok := range tokens {
-			if tok.Kind == lexer.ILLEGAL {
-				return fmt.Errorf("illegal token found: %v", tok.Value)
-			}
-		}
+	t, err := p.Parse()
+	if err != nil {
+		return &ExitError{Code: exitCompile, Err: err}
+	}
 
-		p := parser.NewParser(tokens)
+	debug, _ := cmd.Flags().GetBool("debug")
+	if debug {
+		fmt.Println("Generated AST:")
+		fmt.Println()
+		fmt.Println(ast.PrintAST(t, 0))
+	}
 
-		t := p.ParseExpr()
+	env, err := ast.Bind(t, vars)
+	if err != nil {
+		return &ExitError{Code: exitCompile, Err: err}
+	}
 
-		debug, _ := cmd.Flags().GetBool("debug")
-		if debug {
-			fmt.Println("Generated AST:")
-			fmt.Println()
-			fmt.Println(ast.PrintAST(t, 0))
-		}
+	mode := inputMode{format: inFormat, csv: csvOpts, xml: xmlOpts}
+	mode.raw, _ = cmd.Flags().GetBool("raw-input")
+	mode.slurp, _ = cmd.Flags().GetBool("slurp")
+	mode.seq, _ = cmd.Flags().GetBool("seq")
+	mode.streamErrors, _ = cmd.Flags().GetBool("stream-errors")
+	mode.stream, _ = cmd.Flags().GetBool("stream")
+	mode.stream = mode.stream || mode.streamErrors
+	in := newInputs(files, mode, cmd.ErrOrStderr())
+	if !mode.slurp && inFormat == "json" {
+		// a slurped input is the array of all values, not one of them
+		in.projection = ast.Projection(t)
+	}
+	defer in.close()
 
-		obj, err := json.ParseObject(r)
+	r := &runner{cmd: cmd, program: t, env: env.WithInputs(in), opts: outputOptions(cmd), format: outFormat}
+	if nullInput {
+		r.process(nil)
+	}
+	for !nullInput && r.halt == nil {
+		obj, err := in.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return err
+			return &ExitError{Code: exitUsage, Err: err}
 		}
-		stream := stream.NewS(obj)
+		r.process(obj)
+	}
 
-		result := ast.TransformStream(stream, t)
-		fmt.Printf("%s", result.String())
+	r.flush()
+	exitStatus, _ := cmd.Flags().GetBool("exit-status")
+	err = r.exit(exitStatus)
+	if in.openFailed && r.halt == nil {
+		// every file that could be read was processed, as in jq
+		return &ExitError{Code: exitUsage}
+	}
+	return err
+}
 
-		return nil
-	},
+// readProgram returns the program, read from the file given with -f or taken
+// from the first argument, and the arguments that follow it.
+func readProgram(flags *pflag.FlagSet, args []string) (string, []string, error) {
+	if file, _ := flags.GetString("from-file"); file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", nil, fmt.Errorf("could not open %s: %w", file, err)
+		}
+		return string(b), args, nil
+	}
+	if len(args) < 1 {
+		return "", nil, fmt.Errorf("no program provided")
+	}
+	return args[0], args[1:], nil
 }
 
 func requireStdin() error {
@@ -91,4 +214,31 @@ func requireStdin() error {
 
 func init() {
 	RootCmd.Flags().BoolP("debug", "d", false, "Displays AST from requested expression")
+	RootCmd.Flags().BoolP("ascii-output", "a", false, "Escapes all non-ASCII characters in the output")
+	RootCmd.Flags().BoolP("color-output", "C", false, "Colorizes the output, even when it is not a terminal")
+	RootCmd.Flags().BoolP("monochrome-output", "M", false, "Disables colors, even when the output is a terminal")
+	RootCmd.Flags().String("input-format", "json", "Reads inputs as json, yaml, toml, csv, tsv, xml, msgpack or cbor")
+	RootCmd.Flags().String("output-format", "json", "Writes outputs as json, yaml, toml, csv, tsv, msgpack, cbor, table or markdown")
+	RootCmd.Flags().Bool("no-header", false, "Reads every csv or tsv row as an array, instead of naming fields after the first row")
+	RootCmd.Flags().String("delimiter", "", "Separates the fields of csv or tsv input (default , for csv and tab for tsv)")
+	RootCmd.Flags().String("quoting", "", "Reads quotes in csv or tsv input as strict, lazy or none (default strict for csv and none for tsv)")
+	RootCmd.Flags().Bool("infer-types", false, "Reads csv or tsv fields that look like numbers or booleans as such, and empty ones as null")
+	RootCmd.Flags().Bool("xml-strip-namespaces", false, "Drops namespace prefixes and declarations from the names of xml input")
+	RootCmd.Flags().Bool("seq", false, "Reads and writes RFC 7464 JSON text sequences, with an RS before every value")
+	RootCmd.Flags().Bool("stream", false, "Reads inputs as [path, leaf] events, without loading whole values into memory")
+	RootCmd.Flags().Bool("stream-errors", false, "Like --stream, but invalid JSON yields an [error, path] event instead of failing")
+	RootCmd.Flags().BoolP("exit-status", "e", false, "Exits with 1 if the last output is false or null, and 4 if there is no output")
+	RootCmd.Flags().BoolP("null-input", "n", false, "Runs the program once with null as input instead of reading inputs")
+	RootCmd.Flags().BoolP("slurp", "s", false, "Reads all inputs into an array and runs the program once on it")
+	RootCmd.Flags().BoolP("raw-input", "R", false, "Reads each line of input as a string (the whole text with -s)")
+	RootCmd.Flags().StringP("from-file", "f", "", "Reads the program from a file instead of the first argument")
+	RootCmd.Flags().StringArray("arg", nil, "Binds $name to the string value (--arg name value)")
+	RootCmd.Flags().StringArray("argjson", nil, "Binds $name to the JSON value (--argjson name json)")
+	RootCmd.Flags().StringArray("slurpfile", nil, "Binds $name to an array of the JSON values in a file (--slurpfile name file)")
+	RootCmd.Flags().StringArray("rawfile", nil, "Binds $name to the contents of a file (--rawfile name file)")
+	RootCmd.Flags().Bool("args", false, "Remaining arguments are positional strings in $ARGS.positional")
+	RootCmd.Flags().Bool("jsonargs", false, "Remaining arguments are positional JSON values in $ARGS.positional")
+
+	RootCmd.AddCommand(formatCommand("yaml"))
+	RootCmd.AddCommand(formatCommand("toml"))
 }
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	json "github.com/jmpargana/gq/internal/gqjson"
+	"github.com/spf13/pflag"
+)
+
+// namedFlags take both a variable name and a value, which pflag cannot
+// express, so they are joined into a single argument before parsing.
+var namedFlags = map[string]bool{
+	"--arg":       true,
+	"--argjson":   true,
+	"--slurpfile": true,
+	"--rawfile":   true,
+}
+
+// nameSep separates the name and the value of a joined named flag. It is NUL,
+// which no argument can hold, so that names and values may contain anything
+// else, "=" included.
+const nameSep = "\x00"
+
+// JoinNamedArgs rewrites `--arg name value` into a single `--arg=name\x00value`
+// argument so that pflag sees a single value, and reports named flags that
+// are not followed by both. Everything after -- is left untouched.
+func JoinNamedArgs(args []string) ([]string, error) {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(out, args[i:]...), nil
+		}
+		if namedFlags[args[i]] {
+			if i+2 >= len(args) {
+				return nil, fmt.Errorf("%s takes two parameters (e.g. %s varname value)", args[i], args[i])
+			}
+			out = append(out, args[i]+"="+args[i+1]+nameSep+args[i+2])
+			i += 2
+			continue
+		}
+		out = append(out, args[i])
+	}
+	return out, nil
+}
+
+// parseJSONText parses s as exactly one JSON value.
+func parseJSONText(s string) (any, error) {
+	r := bufio.NewReader(strings.NewReader(s))
+	v, err := json.ParseValue(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := json.ParseValue(r); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// slurpFile reads every JSON value in the file at path into an array.
+func slurpFile(path string) ([]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := []any{}
+	r := bufio.NewReader(f)
+	for {
+		v, err := json.ParseValue(r)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+}
+
+// namedVars collects the variables given with --arg, --argjson, --slurpfile
+// and --rawfile, keyed by name.
+func namedVars(flags *pflag.FlagSet) (*json.Object, error) {
+	named := json.NewObject(0)
+	for _, name := range []string{"arg", "argjson", "slurpfile", "rawfile"} {
+		values, _ := flags.GetStringArray(name)
+		for _, nv := range values {
+			k, v, ok := strings.Cut(nv, nameSep)
+			if !ok {
+				return nil, fmt.Errorf("--%s takes two parameters (e.g. --%s varname value)", name, name)
+			}
+			switch name {
+			case "arg":
+				named.Set(k, v)
+			case "argjson":
+				val, err := parseJSONText(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSON text passed to --argjson: %v", err)
+				}
+				named.Set(k, val)
+			case "slurpfile":
+				vals, err := slurpFile(v)
+				if err != nil {
+					return nil, fmt.Errorf("bad JSON in --slurpfile %s %s: %v", k, v, err)
+				}
+				named.Set(k, vals)
+			case "rawfile":
+				b, err := os.ReadFile(v)
+				if err != nil {
+					return nil, fmt.Errorf("could not read --rawfile %s %s: %v", k, v, err)
+				}
+				named.Set(k, string(b))
+			}
+		}
+	}
+	return named, nil
+}
+
+// programVars builds the predefined variables of the program: one per named
+// argument plus $ARGS. Positional arguments are kept as strings, or parsed as
+// JSON with --jsonargs.
+func programVars(flags *pflag.FlagSet, named *json.Object, positional []string) (map[string]any, error) {
+	jsonArgs, _ := flags.GetBool("jsonargs")
+	pos := []any{}
+	for _, a := range positional {
+		if !jsonArgs {
+			pos = append(pos, a)
+			continue
+		}
+		v, err := parseJSONText(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON text passed to --jsonargs: %v", err)
+		}
+		pos = append(pos, v)
+	}
+
+	vars := map[string]any{"ARGS": json.ObjectOf("positional", pos, "named", named)}
+	for k, v := range named.All() {
+		vars[k] = v
+	}
+	return vars, nil
+}
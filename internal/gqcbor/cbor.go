@@ -0,0 +1,364 @@
+// Package gqcbor converts between CBOR (RFC 8949) and the values gq works
+// on, which are the same as those of gqjson.
+//
+// Integers, including bignums, stay exact when they fit an int64 and are
+// otherwise read as numbers like those of JSON. Byte strings are read as
+// base64 strings, undefined as null and maps with keys other than strings
+// have those keys written as JSON. Date and time tags (0 and 1) and the
+// self-described CBOR tag are read as their content, any other tag as
+// {"tag": number, "value": content} and unassigned simple values as
+// {"simple": number}. Written values only use null,
+// booleans, integers, 64 bit floats, text strings, arrays and maps, so tags
+// and byte strings come back as what they were read as.
+package gqcbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// major types
+const (
+	majorUint = iota
+	majorNegInt
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// indefinite is the additional information of indefinite lengths.
+const indefinite = 31
+
+// errBreak is returned when the break ending an indefinite length item is
+// read in place of a value.
+var errBreak = errors.New("unexpected break")
+
+// Decoder reads a series of CBOR values one at a time.
+type Decoder struct {
+	r *bufio.Reader
+	// depth is the number of values being read, one inside the other
+	depth int
+}
+
+// maxDepth bounds how deeply values may be nested, like the YAML parser, so that
+// hostile input cannot exhaust the stack.
+const maxDepth = 10000
+
+var errDepth = errors.New("too deeply nested")
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br}
+}
+
+// Next returns the next value, or io.EOF after the last one.
+func (d *Decoder) Next() (any, error) {
+	if _, err := d.r.Peek(1); err == io.EOF {
+		return nil, io.EOF
+	}
+	v, err := d.value()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CBOR: %w", err)
+	}
+	return v, nil
+}
+
+// head reads the initial byte of an item and the argument that follows.
+func (d *Decoder) head() (major byte, info byte, arg uint64, err error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		var buf [8]byte
+		size := 1 << (info - 24)
+		if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+			return 0, 0, 0, err
+		}
+		return major, info, binary.BigEndian.Uint64(buf[:]), nil
+	case info == indefinite:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, fmt.Errorf("reserved additional information %d", info)
+}
+
+func (d *Decoder) value() (any, error) {
+	if d.depth >= maxDepth {
+		return nil, errDepth
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if info == indefinite && (major == majorUint || major == majorNegInt || major == majorTag) {
+		return nil, fmt.Errorf("indefinite length for major type %d", major)
+	}
+
+	switch major {
+	case majorUint:
+		if arg > math.MaxInt64 {
+			return float64(arg), nil
+		}
+		return int64(arg), nil
+	case majorNegInt:
+		if arg > math.MaxInt64 {
+			return -1 - float64(arg), nil
+		}
+		return -1 - int64(arg), nil
+	case majorBytes:
+		b, err := d.str(major, info, arg)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case majorText:
+		b, err := d.str(major, info, arg)
+		return string(b), err
+	case majorArray:
+		out := []any{}
+		for i := uint64(0); info == indefinite || i < arg; i++ {
+			v, err := d.value()
+			if err == errBreak && info == indefinite {
+				return out, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case majorMap:
+		out := gqjson.NewObject(0)
+		for i := uint64(0); info == indefinite || i < arg; i++ {
+			k, err := d.value()
+			if err == errBreak && info == indefinite {
+				return out, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = gqjson.NewJSON(k).Compact()
+			}
+			out.Set(key, v)
+		}
+		return out, nil
+	case majorTag:
+		return d.tag(arg)
+	}
+	return d.simple(info, arg)
+}
+
+// str reads a byte or text string, joining the chunks of indefinite length
+// ones. The buffer grows as bytes are read, so that a wrong length does not
+// allocate more than the input holds.
+func (d *Decoder) str(major, info byte, n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if info != indefinite {
+		if n > math.MaxInt64 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		_, err := io.CopyN(&buf, d.r, int64(n))
+		return buf.Bytes(), err
+	}
+	for {
+		m, info, n, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m == majorSimple && info == indefinite {
+			return buf.Bytes(), nil
+		}
+		if m != major || info == indefinite {
+			return nil, fmt.Errorf("invalid chunk of major type %d in an indefinite length string", m)
+		}
+		if n > math.MaxInt64 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tag reads the content of a tag.
+func (d *Decoder) tag(n uint64) (any, error) {
+	if n == 2 || n == 3 {
+		return d.bignum(n == 3)
+	}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 || n == 1 || n == 55799 {
+		return v, nil
+	}
+	return gqjson.ObjectOf("tag", int64(min(n, math.MaxInt64)), "value", v), nil
+}
+
+// bignum reads the byte string of a bignum as a number, which stays exact
+// when it fits an int64.
+func (d *Decoder) bignum(negative bool) (any, error) {
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != majorBytes {
+		return nil, fmt.Errorf("bignum content of major type %d, expected a byte string", major)
+	}
+	b, err := d.str(major, info, arg)
+	if err != nil {
+		return nil, err
+	}
+	n := new(big.Int).SetBytes(b)
+	if negative {
+		n.Sub(big.NewInt(-1), n)
+	}
+	if n.IsInt64() {
+		return n.Int64(), nil
+	}
+	f, _ := new(big.Float).SetInt(n).Float64()
+	return f, nil
+}
+
+// simple reads a simple value or float, whose head was already read.
+func (d *Decoder) simple(info byte, arg uint64) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case indefinite:
+		return nil, errBreak
+	}
+	return gqjson.ObjectOf("simple", int64(arg)), nil
+}
+
+// halfFloat converts an IEEE 754 half precision float.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// Format returns v as CBOR, in a string of bytes like those of the other
+// formats. Lengths and integers take their shortest form and map keys keep
+// their order.
+func Format(v any) (string, error) {
+	var buf bytes.Buffer
+	encode(&buf, v)
+	return buf.String(), nil
+}
+
+func encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case int64:
+		if v >= 0 {
+			writeHead(buf, majorUint, uint64(v))
+		} else {
+			writeHead(buf, majorNegInt, uint64(-1-v))
+		}
+	case float64:
+		buf.WriteByte(0xfb)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeHead(buf, majorArray, uint64(len(v)))
+		for _, e := range v {
+			encode(buf, e)
+		}
+	case *gqjson.Object:
+		writeHead(buf, majorMap, uint64(v.Len()))
+		for k, e := range v.All() {
+			encode(buf, k)
+			encode(buf, e)
+		}
+	default:
+		panic(fmt.Sprintf("gqcbor: unsupported value %T", v))
+	}
+}
+
+// writeHead writes the initial byte of an item and its argument in the
+// shortest form.
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
@@ -0,0 +1,142 @@
+package gqcbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+func decodeHex(t *testing.T, s string) (any, error) {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid test input: %v", err)
+	}
+	return NewDecoder(bytes.NewReader(b)).Next()
+}
+
+// Examples from RFC 8949 appendix A.
+func TestDecoder(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+		want  any
+	}{
+		{desc: "uint", input: "1903e8", want: int64(1000)},
+		{desc: "negative", input: "3903e7", want: int64(-1000)},
+		{desc: "uint64 overflow", input: "1bffffffffffffffff", want: 18446744073709551615.0},
+		{desc: "bignum", input: "c249010000000000000000", want: 18446744073709551616.0},
+		{desc: "negative bignum", input: "c349010000000000000000", want: -18446744073709551617.0},
+		{desc: "small bignum", input: "c2482000000000000001", want: int64(1)<<61 + 1},
+		{desc: "small negative bignum", input: "c3487fffffffffffffff", want: int64(math.MinInt64)},
+		{desc: "half float", input: "f93e00", want: 1.5},
+		{desc: "half float subnormal", input: "f90001", want: 5.960464477539063e-8},
+		{desc: "float32", input: "fa47c35000", want: 100000.0},
+		{desc: "undefined", input: "f7", want: nil},
+		{desc: "simple", input: "f818", want: gqjson.ObjectOf("simple", int64(24))},
+		{desc: "bytes", input: "4401020304", want: "AQIDBA=="},
+		{desc: "indefinite text", input: "7f657374726561646d696e67ff", want: "streaming"},
+		{desc: "indefinite array", input: "9f018202039f0405ffff", want: []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{desc: "indefinite map", input: "bf61610161629f0203ffff", want: gqjson.ObjectOf("a", int64(1), "b", []any{int64(2), int64(3)})},
+		{desc: "int keys", input: "a201020304", want: gqjson.ObjectOf("1", int64(2), "3", int64(4))},
+		{desc: "date string", input: "c074323031332d30332d32315432303a30343a30305a", want: "2013-03-21T20:04:00Z"},
+		{desc: "epoch", input: "c11a514b67b0", want: int64(1363896240)},
+		{desc: "other tag", input: "d82076687474703a2f2f7777772e6578616d706c652e636f6d", want: gqjson.ObjectOf("tag", int64(32), "value", "http://www.example.com")},
+		{desc: "self described", input: "d9d9f7f5", want: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := decodeHex(t, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("failed comparison\ngot: %#v\nexpected: %#v\n", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestHalfFloat(t *testing.T) {
+	if f := halfFloat(0x7c00); !math.IsInf(f, 1) {
+		t.Fatalf("expected +Inf, got %v", f)
+	}
+	if f := halfFloat(0x7e00); !math.IsNaN(f) {
+		t.Fatalf("expected NaN, got %v", f)
+	}
+	if f := halfFloat(0xc400); f != -4 {
+		t.Fatalf("expected -4, got %v", f)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	testCases := []struct {
+		desc, input, err string
+	}{
+		{desc: "truncated", input: "8301", err: "unexpected EOF"},
+		{desc: "stray break", input: "ff", err: "unexpected break"},
+		{desc: "break in definite array", input: "82ff", err: "unexpected break"},
+		{desc: "reserved", input: "1c", err: "reserved additional information 28"},
+		{desc: "bad chunk", input: "7f4161ff", err: "invalid chunk"},
+		{desc: "bignum of text", input: "c26161", err: "bignum content"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := decodeHex(t, tC.input)
+			if err == nil || !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
+
+func TestDecoderDepth(t *testing.T) {
+	deep := strings.Repeat("81", 2*maxDepth) + "01"
+	if _, err := decodeHex(t, deep); err == nil || err.Error() != "invalid CBOR: too deeply nested" {
+		t.Fatalf("expected too deeply nested error, got: %v", err)
+	}
+	ok := strings.Repeat("81", maxDepth-1) + "01"
+	if _, err := decodeHex(t, ok); err != nil {
+		t.Fatalf("expected no error at depth %d, instead got: %v", maxDepth, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	values := []any{
+		nil, false, int64(23), int64(-24), int64(-25), int64(1000000), int64(-1) << 40,
+		math.MaxFloat64, "ü", []any{int64(1)},
+		gqjson.ObjectOf("bb", int64(1), "c", []any{}),
+	}
+	var buf bytes.Buffer
+	for _, v := range values {
+		s, err := Format(v)
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		buf.WriteString(s)
+	}
+	d := NewDecoder(&buf)
+	for _, want := range values {
+		got, err := d.Next()
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("failed round trip\ngot: %#v\nexpected: %#v\n", got, want)
+		}
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+
+	got, _ := Format(gqjson.ObjectOf("bb", int64(1), "c", int64(2)))
+	if want := "\xa2\x62bb\x01\x61c\x02"; got != want {
+		t.Fatalf("expected keys in order %q, got %q", want, got)
+	}
+}
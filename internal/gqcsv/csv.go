@@ -0,0 +1,202 @@
+// Package gqcsv reads CSV and TSV files as the values gq works on, one
+// value per row.
+package gqcsv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// Quoting is how quotes in fields are read.
+type Quoting int
+
+const (
+	// Strict follows RFC 4180: a field may be quoted, and quotes inside a
+	// quoted field are doubled.
+	Strict Quoting = iota
+	// Lazy is Strict also accepting quotes inside unquoted fields and
+	// single quotes inside quoted ones.
+	Lazy
+	// None reads quotes as any other character, so that a row is a line
+	// split at every delimiter.
+	None
+)
+
+// ParseQuoting returns the Quoting named strict, lazy or none.
+func ParseQuoting(s string) (Quoting, error) {
+	switch s {
+	case "strict":
+		return Strict, nil
+	case "lazy":
+		return Lazy, nil
+	case "none":
+		return None, nil
+	}
+	return 0, fmt.Errorf("unknown quoting %q, expected one of strict, lazy, none", s)
+}
+
+// Options are the settings of a Decoder.
+type Options struct {
+	// Delimiter separates the fields of a row.
+	Delimiter rune
+	// Header makes the first row name the fields of the others, which are
+	// then objects. Without it rows are arrays.
+	Header  bool
+	Quoting Quoting
+	// InferTypes reads numbers and booleans as such and empty fields as
+	// null, instead of as strings.
+	InferTypes bool
+}
+
+// Decoder reads the rows of a CSV or TSV file one at a time.
+type Decoder struct {
+	opts Options
+	// read returns the next row, or io.EOF after the last one
+	read   func() ([]string, error)
+	header []string
+	// first is set until the first row was read
+	first bool
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader, opts Options) *Decoder {
+	d := &Decoder{opts: opts, first: true}
+	if opts.Quoting == None {
+		d.read = splitter(bufio.NewReader(r), opts.Delimiter)
+	} else {
+		c := csv.NewReader(r)
+		c.Comma = opts.Delimiter
+		c.LazyQuotes = opts.Quoting == Lazy
+		c.ReuseRecord = true
+		d.read = c.Read
+	}
+	return d
+}
+
+// Next returns the next row, or io.EOF after the last one. Rows must have as
+// many fields as the first one.
+func (d *Decoder) Next() (any, error) {
+	row, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	if d.opts.Header && d.header == nil {
+		if err := d.setHeader(row); err != nil {
+			return nil, err
+		}
+		if row, err = d.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.header == nil {
+		out := make([]any, len(row))
+		for i, f := range row {
+			out[i] = d.field(f)
+		}
+		return out, nil
+	}
+	out := gqjson.NewObject(len(row))
+	for i, f := range row {
+		out.Set(d.header[i], d.field(f))
+	}
+	return out, nil
+}
+
+// next reads a row, dropping the byte order mark spreadsheets put before the
+// first one.
+func (d *Decoder) next() ([]string, error) {
+	row, err := d.read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, fmt.Errorf("invalid CSV: line %d: %v", parseErr.Line, parseErr.Err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if d.first && len(row) > 0 {
+		row[0] = strings.TrimPrefix(row[0], "\ufeff")
+	}
+	d.first = false
+	return row, nil
+}
+
+func (d *Decoder) setHeader(row []string) error {
+	seen := make(map[string]bool, len(row))
+	for _, name := range row {
+		if seen[name] {
+			return fmt.Errorf("invalid CSV: duplicate column %q in the header", name)
+		}
+		seen[name] = true
+	}
+	d.header = append([]string{}, row...)
+	return nil
+}
+
+// number matches JSON numbers, so that fields like 007, 1_000 or Inf stay
+// strings.
+var number = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// field converts a field, inferring its type if asked to.
+func (d *Decoder) field(s string) any {
+	if !d.opts.InferTypes {
+		return s
+	}
+	switch {
+	case s == "":
+		return nil
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case number.MatchString(s):
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// splitter returns a reader of rows that are lines split at every delimiter.
+// Empty lines are skipped, as encoding/csv does.
+func splitter(r *bufio.Reader, delim rune) func() ([]string, error) {
+	line, fields := 0, -1
+	return func() ([]string, error) {
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			if s == "" {
+				return nil, io.EOF
+			}
+			line++
+			s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+			if s == "" {
+				continue
+			}
+			row := strings.Split(s, string(delim))
+			if fields < 0 {
+				fields = len(row)
+			}
+			if len(row) != fields {
+				return nil, &csv.ParseError{StartLine: line, Line: line, Err: csv.ErrFieldCount}
+			}
+			return row, nil
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package gqcsv
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+func readAll(input string, opts Options) ([]any, error) {
+	d := NewDecoder(strings.NewReader(input), opts)
+	var out []any
+	for {
+		v, err := d.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	csv := Options{Delimiter: ',', Header: true}
+	testCases := []struct {
+		desc  string
+		input string
+		opts  Options
+		want  []any
+	}{
+		{
+			desc:  "header",
+			input: "a,b\n1,\"x, \"\"y\"\"\"\n",
+			opts:  csv,
+			want:  []any{gqjson.ObjectOf("a", "1", "b", `x, "y"`)},
+		},
+		{
+			desc:  "no header",
+			input: "a,b\r\n1,2\r\n",
+			opts:  Options{Delimiter: ','},
+			want:  []any{[]any{"a", "b"}, []any{"1", "2"}},
+		},
+		{
+			desc:  "header only",
+			input: "a,b\n",
+			opts:  csv,
+		},
+		{
+			desc:  "byte order mark",
+			input: "\ufeffa\n1\n",
+			opts:  csv,
+			want:  []any{gqjson.ObjectOf("a", "1")},
+		},
+		{
+			desc:  "types",
+			input: "a,b,c,d,e,f,g\n1,-2.5,true,,007,1e400,99999999999999999999\n",
+			opts:  Options{Delimiter: ',', Header: true, InferTypes: true},
+			want: []any{gqjson.ObjectOf(
+				"a", int64(1),
+				"b", -2.5,
+				"c", true,
+				"d", nil,
+				"e", "007",
+				"f", "1e400",
+				"g", 1e20,
+			)},
+		},
+		{
+			desc:  "lazy quotes",
+			input: "a\tb\nsay \"hi\"\t2\n",
+			opts:  Options{Delimiter: '\t', Header: true, Quoting: Lazy},
+			want:  []any{gqjson.ObjectOf("a", `say "hi"`, "b", "2")},
+		},
+		{
+			desc:  "no quoting",
+			input: "a\tb\n\"x\t\"y\n\n",
+			opts:  Options{Delimiter: '\t', Header: true, Quoting: None},
+			want:  []any{gqjson.ObjectOf("a", `"x`, "b", `"y`)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := readAll(tC.input, tC.opts)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+		opts  Options
+		err   string
+	}{
+		{
+			desc:  "missing field",
+			input: "a,b\n1\n",
+			opts:  Options{Delimiter: ',', Header: true},
+			err:   "invalid CSV: line 2: wrong number of fields",
+		},
+		{
+			desc:  "missing field without quoting",
+			input: "a\tb\n1\n",
+			opts:  Options{Delimiter: '\t', Header: true, Quoting: None},
+			err:   "invalid CSV: line 2: wrong number of fields",
+		},
+		{
+			desc:  "bare quote",
+			input: "a\nsay \"hi\"\n",
+			opts:  Options{Delimiter: ',', Header: true},
+			err:   "invalid CSV: line 2",
+		},
+		{
+			desc:  "duplicate column",
+			input: "a,a\n1,2\n",
+			opts:  Options{Delimiter: ',', Header: true},
+			err:   `duplicate column "a"`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := readAll(tC.input, tC.opts)
+			if err == nil || !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
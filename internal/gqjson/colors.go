@@ -0,0 +1,56 @@
+package gqjson
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Colors holds the SGR parameters, such as "1;30", that Format uses for each
+// kind of value.
+type Colors struct {
+	Null       string
+	False      string
+	True       string
+	Numbers    string
+	Strings    string
+	Arrays     string
+	Objects    string
+	ObjectKeys string
+}
+
+// DefaultColors are the colors jq uses.
+var DefaultColors = Colors{
+	Null:       "1;30",
+	False:      "0;39",
+	True:       "0;39",
+	Numbers:    "0;39",
+	Strings:    "0;32",
+	Arrays:     "1;39",
+	Objects:    "1;39",
+	ObjectKeys: "34;1",
+}
+
+var sgrParams = regexp.MustCompile(`^[0-9;]*$`)
+
+// ParseColors reads colors in the format of jq's JQ_COLORS: a colon separated
+// list for null, false, true, numbers, strings, arrays, objects and object
+// keys. Colors that are left out or empty keep their default.
+func ParseColors(spec string) (Colors, error) {
+	c := DefaultColors
+	fields := []*string{&c.Null, &c.False, &c.True, &c.Numbers, &c.Strings, &c.Arrays, &c.Objects, &c.ObjectKeys}
+	parts := strings.Split(spec, ":")
+	if len(parts) > len(fields) {
+		return DefaultColors, fmt.Errorf("too many colors in %q", spec)
+	}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		if !sgrParams.MatchString(part) {
+			return DefaultColors, fmt.Errorf("invalid color %q", part)
+		}
+		*fields[i] = part
+	}
+	return c, nil
+}
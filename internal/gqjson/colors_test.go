@@ -0,0 +1,43 @@
+package gqjson
+
+import (
+	"testing"
+)
+
+func TestFormatColors(t *testing.T) {
+	colors := DefaultColors
+	got := NewJSON([]any{nil, ObjectOf("a", "b")}).Format(Options{Colors: &colors})
+	want := "\x1b[1;39m[\x1b[0m\n" +
+		"  \x1b[1;30mnull\x1b[0m\x1b[1;39m,\x1b[0m\n" +
+		"  \x1b[1;39m{\x1b[0m\n" +
+		"    \x1b[34;1m\"a\"\x1b[0m\x1b[1;39m:\x1b[0m \x1b[0;32m\"b\"\x1b[0m\n" +
+		"  \x1b[1;39m}\x1b[0m\n" +
+		"\x1b[1;39m]\x1b[0m\n"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseColors(t *testing.T) {
+	testCases := []struct {
+		desc, spec string
+		colors     Colors
+		err        bool
+	}{
+		{desc: "partial", spec: "0;31:0;32", colors: Colors{Null: "0;31", False: "0;32", True: "0;39", Numbers: "0;39", Strings: "0;32", Arrays: "1;39", Objects: "1;39", ObjectKeys: "34;1"}},
+		{desc: "empty fields keep defaults", spec: "::::4::1:33", colors: Colors{Null: "1;30", False: "0;39", True: "0;39", Numbers: "0;39", Strings: "4", Arrays: "1;39", Objects: "1", ObjectKeys: "33"}},
+		{desc: "invalid", spec: "red", colors: DefaultColors, err: true},
+		{desc: "too many", spec: "1:1:1:1:1:1:1:1:1", colors: DefaultColors, err: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := ParseColors(tC.spec)
+			if (err != nil) != tC.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tC.colors {
+				t.Fatalf("expected %+v, got %+v", tC.colors, got)
+			}
+		})
+	}
+}
@@ -2,58 +2,155 @@ package gqjson
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 )
 
-func parseString(r *bufio.Reader) (string, error) {
+// RS starts every record of an RFC 7464 JSON text sequence.
+const RS = '\x1e'
+
+// errRecordEnd is returned when a value is cut short by an RS. The RS is
+// left unread so that the next record can still be parsed.
+var errRecordEnd = errors.New("unfinished text at record separator")
+
+// readRune returns the next rune. An RS is never consumed, since it can only
+// appear between values.
+func readRune(r *reader) (rune, error) {
+	ch, _, err := r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if ch == RS {
+		r.UnreadRune()
+		return 0, errRecordEnd
+	}
+	return ch, nil
+}
+
+// readToken returns the next rune that is not whitespace.
+func readToken(r *reader) (rune, error) {
+	for {
+		ch, err := readRune(r)
+		if err != nil || !isSpace(ch) {
+			return ch, err
+		}
+	}
+}
+
+func parseString(r *reader) (string, error) {
 	var sb strings.Builder
-	var ignoreNext = false
 	for {
-		ch, _, err := r.ReadRune()
+		ch, err := readRune(r)
 		if err != nil {
 			return sb.String(), fmt.Errorf("failed parsing string after %s with: %v", sb.String(), err)
 		}
-		if ch == '\\' {
-			ignoreNext = true
+		switch ch {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			c, err := parseEscape(r)
+			if err != nil {
+				return sb.String(), fmt.Errorf("failed parsing string after %s with: %v", sb.String(), err)
+			}
+			sb.WriteRune(c)
+		default:
+			sb.WriteRune(ch)
 		}
-		if ignoreNext {
-			ignoreNext = false
-			continue
+	}
+}
+
+// skipString reads past a string like parseString, without keeping it.
+func skipString(r *reader) error {
+	for {
+		ch, err := readRune(r)
+		if err != nil {
+			return fmt.Errorf("failed parsing string with: %v", err)
 		}
-		if ch == '"' {
-			return sb.String(), nil
+		switch ch {
+		case '"':
+			return nil
+		case '\\':
+			if _, err := parseEscape(r); err != nil {
+				return fmt.Errorf("failed parsing string with: %v", err)
+			}
 		}
-		sb.WriteRune(ch)
 	}
 }
 
-func parseNumber(ch rune, r *bufio.Reader) (any, error) {
+var escapes = map[rune]rune{
+	'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t',
+}
+
+// parseEscape reads the escape sequence after a backslash. \u escapes may be
+// UTF-16 surrogate pairs.
+func parseEscape(r *reader) (rune, error) {
+	ch, err := readRune(r)
+	if err != nil {
+		return 0, err
+	}
+	if ch != 'u' {
+		e, ok := escapes[ch]
+		if !ok {
+			return 0, fmt.Errorf("invalid escape \\%c", ch)
+		}
+		return e, nil
+	}
+	c, err := parseHex(r)
+	if err != nil {
+		return 0, err
+	}
+	if utf16.IsSurrogate(c) {
+		if next, err := r.Peek(2); err == nil && string(next) == `\u` {
+			r.Discard(2)
+			low, err := parseHex(r)
+			if err != nil {
+				return 0, err
+			}
+			c = utf16.DecodeRune(c, low)
+		} else {
+			c = unicode.ReplacementChar
+		}
+	}
+	return c, nil
+}
+
+func parseHex(r *reader) (rune, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(string(b[:]), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid \\u escape %q", string(b[:]))
+	}
+	return rune(n), nil
+}
+
+// parseNumber reads a number up to the next delimiter. Integers that do not
+// fit in an int64 are read as floats.
+func parseNumber(ch rune, r *reader) (any, error) {
 	b := []byte{byte(ch)}
 	for {
 		next, err := r.Peek(1)
-		if err != nil || next[0] == ',' || next[0] == '}' || next[0] == ']' {
+		if err != nil || next[0] == ',' || next[0] == '}' || next[0] == ']' || next[0] == RS || isSpace(rune(next[0])) {
 			if err != nil && err != io.EOF {
 				return nil, fmt.Errorf("failed parsing number: %v", err)
 			}
 			break
 		}
-		ch, err := r.ReadByte()
-		if err != nil {
-			if err != io.EOF {
-				return nil, fmt.Errorf("failed parsing number: %v", err)
-			}
-			break
-		}
-		b = append(b, ch)
+		r.ReadByte()
+		b = append(b, next[0])
 	}
 
 	for _, c := range b {
 		if c == '.' || c == 'e' || c == 'E' {
 			f, err := strconv.ParseFloat(string(b), 64)
-			if err != nil {
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
 				return nil, fmt.Errorf("failed parsing float: %v", err)
 			}
 			return f, nil
@@ -61,143 +158,152 @@ func parseNumber(ch rune, r *bufio.Reader) (any, error) {
 	}
 
 	i, err := strconv.ParseInt(string(b), 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		f, _ := strconv.ParseFloat(string(b), 64)
+		return f, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed parsing int: %v", err)
 	}
 	return i, nil
 }
 
-func parseBool(ch rune, r *bufio.Reader) (bool, error) {
-	out := false
-	n := 4
+func isSpace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func parseBool(ch rune, r *reader) (bool, error) {
+	rest := "alse"
 	if ch == 't' {
-		n = 3
-		out = true
+		rest = "rue"
 	}
-	for i := 0; i < n; i++ {
-		_, _, err := r.ReadRune()
+	for _, want := range rest {
+		ch, err := readRune(r)
 		if err != nil {
 			return false, fmt.Errorf("failed closing bool ident: %s", err)
 		}
+		if ch != want {
+			return false, fmt.Errorf("failed closing bool ident: unexpected %q", ch)
+		}
 	}
-	return out, nil
+	return ch == 't', nil
 }
 
-func parseList(r *bufio.Reader) ([]any, error) {
-	out := []any{}
-	for {
-		ch, _, err := r.ReadRune()
+func parseNull(r *reader) error {
+	for _, want := range "ull" {
+		ch, err := readRune(r)
 		if err != nil {
-			if err != io.EOF {
-				return nil, fmt.Errorf("failed parsing list: %v", err)
-			}
-			break
+			return fmt.Errorf("failed closing null ident: %s", err)
 		}
-		switch ch {
-		case '{':
-			o, err := ParseObject(r)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, o)
-		case ',':
-			continue
-		case ']':
-			return out, nil
-		case '[':
-			l, err := parseList(r)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, l)
-		case '"':
-			s, err := parseString(r)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, s)
-		case 't', 'f':
-			b, err := parseBool(ch, r)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, b)
-		case '1', '2', '3', '4', '5', '6', '7', '8', '9', '0':
-			n, err := parseNumber(ch, r)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, n)
+		if ch != want {
+			return fmt.Errorf("failed closing null ident: unexpected %q", ch)
 		}
 	}
-	return out, fmt.Errorf("unclosed array")
+	return nil
+}
+
+// errUnexpected is returned by parseElement for a character that cannot
+// start a value. Containers report it in their own words.
+type errUnexpected rune
+
+func (e errUnexpected) Error() string {
+	return fmt.Sprintf("unexpected %q", rune(e))
 }
 
+// parseScalar parses the string, number, boolean or null starting with ch.
+// With skip set, strings are validated without being built.
+func parseScalar(ch rune, r *reader, skip bool) (any, error) {
+	switch ch {
+	case '"':
+		if skip {
+			return nil, skipString(r)
+		}
+		return parseString(r)
+	case 't', 'f':
+		return parseBool(ch, r)
+	case 'n':
+		return nil, parseNull(r)
+	case '-', '1', '2', '3', '4', '5', '6', '7', '8', '9', '0':
+		return parseNumber(ch, r)
+	}
+	return nil, errUnexpected(ch)
+}
+
+// ParseObject reads an object or an array from r.
 func ParseObject(r *bufio.Reader) (any, error) {
-	out := map[string]any{}
-	ident := ""
-	key := true
-	pendingKey := ""
+	t := NewTokenizer(r)
+	tok, err := t.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("invalid object: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.Kind != BeginObject && tok.Kind != BeginArray {
+		return nil, fmt.Errorf("invalid object: expected an object or an array")
+	}
+	return t.decode(tok)
+}
+
+// ParseValue reads the next JSON value of any kind from r, skipping the
+// whitespace before it. It returns io.EOF when r holds no more values.
+func ParseValue(r *bufio.Reader) (any, error) {
+	return NewTokenizer(r).Decode()
+}
+
+// SeqError reports a record of a JSON text sequence that did not hold a
+// complete value and was skipped.
+type SeqError struct {
+	Err error
+}
+
+func (e *SeqError) Error() string {
+	return fmt.Sprintf("ignoring parse error: %v", e.Err)
+}
+
+func (e *SeqError) Unwrap() error {
+	return e.Err
+}
+
+// ParseSeqValue reads the next value of an RFC 7464 JSON text sequence, in
+// which every value is preceded by an RS. When a record does not hold a
+// complete value, such as one that was truncated, the rest of it is skipped
+// and a *SeqError is returned, after which reading can go on.
+func ParseSeqValue(r *bufio.Reader) (any, error) {
 	for {
 		ch, _, err := r.ReadRune()
 		if err != nil {
-			if err != io.EOF {
-				return nil, fmt.Errorf("failed parsing object: %v", err)
+			if err == io.EOF {
+				return nil, io.EOF
 			}
+			return nil, fmt.Errorf("failed parsing value: %v", err)
+		}
+		if ch != RS && !isSpace(ch) {
+			r.UnreadRune()
 			break
 		}
-		switch ch {
-		case '[':
-			if pendingKey != "" {
-				l, err := parseList(r)
-				if err != nil {
-					return nil, err
-				}
-				out[pendingKey] = l
-			} else {
-				return parseList(r)
-			}
-		case '{':
-			if pendingKey != "" {
-				o, err := ParseObject(r)
-				if err != nil {
-					return nil, err
-				}
-				out[pendingKey] = o
-			}
-		case '"':
-			s, err := parseString(r)
-			if err != nil {
-				return nil, err
-			}
-			ident = s
-			if key {
-				pendingKey = ident
-			} else {
-				out[pendingKey] = ident
-				pendingKey = ""
-			}
-		case ':':
-			key = false
-		case ',':
-			key = true
-		case 't', 'f':
-			b, err := parseBool(ch, r)
-			if err != nil {
-				return nil, err
+	}
+
+	v, err := ParseValue(r)
+	if err == nil {
+		switch v.(type) {
+		case int64, float64:
+			// A number cut short by the end of a record could have been
+			// longer, so only whitespace may end it.
+			if next, perr := r.Peek(1); perr != nil || !isSpace(rune(next[0])) {
+				err = fmt.Errorf("unfinished number %s", NewJSON(v).Compact())
 			}
-			out[pendingKey] = b
-			pendingKey = ""
-		case '1', '2', '3', '4', '5', '6', '7', '8', '9', '0':
-			n, err := parseNumber(ch, r)
-			if err != nil {
-				return nil, err
+		}
+	}
+	if err != nil {
+		for {
+			next, perr := r.Peek(1)
+			if perr != nil || next[0] == RS {
+				break
 			}
-			out[pendingKey] = n
-			pendingKey = ""
-		case '}':
-			return out, nil
+			r.ReadByte()
 		}
+		return nil, &SeqError{Err: err}
 	}
-	return out, fmt.Errorf("invalid object")
+	return v, nil
 }
@@ -2,6 +2,9 @@ package gqjson
 
 import (
 	"bufio"
+	"errors"
+	"io"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -16,7 +19,12 @@ func TestArray(t *testing.T) {
 		{
 			desc: "multiple entities",
 			s:    `["a", 3, 4.2, true, [1, 2], {"a": "b"}]`,
-			arr:  []interface{}{"a", int64(3), float64(4.2), true, []interface{}{int64(1), int64(2)}, map[string]interface{}{"a": "b"}},
+			arr:  []interface{}{"a", int64(3), float64(4.2), true, []interface{}{int64(1), int64(2)}, ObjectOf("a", "b")},
+		},
+		{
+			desc: "null and negative numbers",
+			s:    `[null, -1, -2.5, {"a": null}]`,
+			arr:  []interface{}{nil, int64(-1), float64(-2.5), ObjectOf("a", nil)},
 		},
 	}
 	for _, tC := range testCases {
@@ -36,20 +44,20 @@ func TestObject(t *testing.T) {
 	testCases := []struct {
 		desc string
 		s    string
-		arr  map[string]interface{}
+		arr  *Object
 	}{
 		{
 			desc: "multiple entities",
 			s:    `{"a": "b", "b": 2, "c": true, "d": [1, 2], "e": {"a": 1}}`,
-			arr: map[string]interface{}{
-				"a": "b",
-				"b": int64(2),
-				"c": true,
-				"d": []interface{}{int64(1), int64(2)},
-				"e": map[string]interface{}{
-					"a": int64(1),
-				},
-			},
+			arr: ObjectOf(
+				"a", "b",
+				"b", int64(2),
+				"c", true,
+				"d", []interface{}{int64(1), int64(2)},
+				"e", ObjectOf(
+					"a", int64(1),
+				),
+			),
 		},
 	}
 	for _, tC := range testCases {
@@ -65,6 +73,40 @@ func TestObject(t *testing.T) {
 	}
 }
 
+func TestParseValue(t *testing.T) {
+	testCases := []struct {
+		desc string
+		s    string
+		vals []any
+	}{
+		{desc: "scalars", s: `1 "a" true null -2.5`, vals: []any{int64(1), "a", true, nil, float64(-2.5)}},
+		{desc: "containers", s: "{\"a\": 1}\n[1, 2]\n", vals: []any{ObjectOf("a", int64(1)), []any{int64(1), int64(2)}}},
+		{desc: "empty", s: "  \n", vals: nil},
+		{desc: "large integer", s: `12345678901234567890`, vals: []any{float64(12345678901234567890)}},
+		{desc: "out of range float", s: `1e1000 -1e1000 1e-1000`, vals: []any{math.Inf(1), math.Inf(-1), float64(0)}},
+		{desc: "escapes", s: `"a\"b\\c\n\u00e9\ud83d\ude00" ["\/"]`, vals: []any{"a\"b\\c\né😀", []any{"/"}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tC.s))
+			var got []any
+			for {
+				v, err := ParseValue(r)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected no error, instead got: %v", err)
+				}
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tC.vals) {
+				t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, tC.vals)
+			}
+		})
+	}
+}
+
 func TestInvalidJSON(t *testing.T) {
 	testCases := []struct {
 		desc, s, err string
@@ -89,6 +131,11 @@ func TestInvalidJSON(t *testing.T) {
 			s:    `{"a": 8.a}`,
 			err:  "failed parsing float",
 		},
+		{
+			desc: "broken null",
+			s:    `{"a": nul}`,
+			err:  "failed closing null",
+		},
 		{
 			desc: "unclosed array",
 			s:    `[1, 2`,
@@ -114,6 +161,26 @@ func TestInvalidJSON(t *testing.T) {
 			s:    `{"a": "\\`,
 			err:  "failed parsing string",
 		},
+		{
+			desc: "missing comma in object",
+			s:    `{"a": 1 "b": 2}`,
+			err:  "invalid object",
+		},
+		{
+			desc: "missing comma in array",
+			s:    `[1 2]`,
+			err:  "unclosed array",
+		},
+		{
+			desc: "misspelled bool",
+			s:    `[trve]`,
+			err:  "failed closing bool",
+		},
+		{
+			desc: "invalid escape",
+			s:    `{"a": "\q"}`,
+			err:  "invalid escape",
+		},
 		{
 			desc: "string",
 			s:    `{"a": "asldkj`,
@@ -142,3 +209,31 @@ func TestInvalidJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSeqValue(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\x1e{\"a\": 1}\n\x1e{\"a\": 2\n\x1e3\x1e4\n\x1e[5]\n\"no rs\"\n"))
+	var got []any
+	skipped := 0
+	for {
+		v, err := ParseSeqValue(r)
+		if err == io.EOF {
+			break
+		}
+		var seqErr *SeqError
+		if errors.As(err, &seqErr) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		got = append(got, v)
+	}
+	want := []any{ObjectOf("a", int64(1)), int64(4), []any{int64(5)}, "no rs"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, want)
+	}
+	if skipped != 2 {
+		t.Fatalf("expected 2 skipped records, got %d", skipped)
+	}
+}
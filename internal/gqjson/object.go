@@ -0,0 +1,104 @@
+package gqjson
+
+import (
+	"fmt"
+	"iter"
+)
+
+// Object is a JSON object. Unlike a map, it keeps its keys in the order they
+// were first set, which is the order they are iterated and written in, as in
+// jq. Values are shared between the evaluations of a program, so an Object
+// must be cloned before it is changed.
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+// NewObject returns an empty Object with room for n keys.
+func NewObject(n int) *Object {
+	return &Object{values: make(map[string]any, n)}
+}
+
+// ObjectOf returns an Object of the keys and values in pairs, in that order,
+// e.g. ObjectOf("a", 1, "b", 2). It panics if a key is not a string.
+func ObjectOf(pairs ...any) *Object {
+	if len(pairs)%2 != 0 {
+		panic("gqjson: ObjectOf called with an odd number of arguments")
+	}
+	o := NewObject(len(pairs) / 2)
+	for i := 0; i < len(pairs); i += 2 {
+		k, ok := pairs[i].(string)
+		if !ok {
+			panic(fmt.Sprintf("gqjson: ObjectOf key %v is not a string", pairs[i]))
+		}
+		o.Set(k, pairs[i+1])
+	}
+	return o
+}
+
+// Len returns the number of keys.
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Get returns the value of key, and whether it is set.
+func (o *Object) Get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets key to v. A new key comes after the others, while one that is
+// already set keeps its place.
+func (o *Object) Set(key string, v any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+// Delete removes key, if it is set.
+func (o *Object) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	keys := make([]string, 0, len(o.keys)-1)
+	for _, k := range o.keys {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		keys = nil
+	}
+	o.keys = keys
+}
+
+// Keys returns the keys in order. The slice must not be changed.
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+// All iterates over the keys and values in order.
+func (o *Object) All() iter.Seq2[string, any] {
+	return func(yield func(string, any) bool) {
+		for _, k := range o.keys {
+			if !yield(k, o.values[k]) {
+				return
+			}
+		}
+	}
+}
+
+// Clone returns a copy of the Object that can be changed without changing
+// it. The values themselves are not copied.
+func (o *Object) Clone() *Object {
+	out := &Object{values: make(map[string]any, len(o.keys))}
+	if len(o.keys) > 0 {
+		out.keys = append(make([]string, 0, len(o.keys)), o.keys...)
+	}
+	for k, v := range o.values {
+		out.values[k] = v
+	}
+	return out
+}
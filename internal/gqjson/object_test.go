@@ -0,0 +1,64 @@
+package gqjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObjectOrder(t *testing.T) {
+	testCases := []struct {
+		desc string
+		edit func(o *Object)
+		keys []string
+		out  string
+	}{
+		{desc: "insertion order", edit: func(o *Object) {}, keys: []string{"b", "a", "c"}, out: `{"b":1,"a":2,"c":3}`},
+		{desc: "new key last", edit: func(o *Object) { o.Set("0", 4) }, keys: []string{"b", "a", "c", "0"}, out: `{"b":1,"a":2,"c":3,"0":4}`},
+		{desc: "set keeps place", edit: func(o *Object) { o.Set("b", 5) }, keys: []string{"b", "a", "c"}, out: `{"b":5,"a":2,"c":3}`},
+		{desc: "delete", edit: func(o *Object) { o.Delete("a"); o.Delete("x") }, keys: []string{"b", "c"}, out: `{"b":1,"c":3}`},
+		{desc: "delete and set again", edit: func(o *Object) { o.Delete("b"); o.Set("b", 1) }, keys: []string{"a", "c", "b"}, out: `{"a":2,"c":3,"b":1}`},
+		{desc: "delete all", edit: func(o *Object) { o.Delete("a"); o.Delete("b"); o.Delete("c") }, out: `{}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			o := ObjectOf("b", int64(1), "a", int64(2), "c", int64(3))
+			tC.edit(o)
+			if !reflect.DeepEqual(o.Keys(), tC.keys) {
+				t.Fatalf("expected keys %q, got %q", tC.keys, o.Keys())
+			}
+			if o.Len() != len(tC.keys) {
+				t.Fatalf("expected length %d, got %d", len(tC.keys), o.Len())
+			}
+			if got := NewJSON(o).Compact(); got != tC.out {
+				t.Fatalf("expected %s, got %s", tC.out, got)
+			}
+		})
+	}
+}
+
+func TestObjectClone(t *testing.T) {
+	o := ObjectOf("a", int64(1), "b", int64(2))
+	c := o.Clone()
+	c.Set("a", int64(3))
+	c.Set("c", int64(4))
+	c.Delete("b")
+	if got := NewJSON(o).Compact(); got != `{"a":1,"b":2}` {
+		t.Fatalf("expected the original unchanged, got %s", got)
+	}
+	if got := NewJSON(c).Compact(); got != `{"a":3,"c":4}` {
+		t.Fatalf("expected the clone changed, got %s", got)
+	}
+}
+
+func TestObjectOfPanics(t *testing.T) {
+	for _, pairs := range [][]any{{"a"}, {1, 2}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected ObjectOf(%v) to panic", pairs)
+				}
+			}()
+			ObjectOf(pairs...)
+		}()
+	}
+}
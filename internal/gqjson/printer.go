@@ -2,7 +2,11 @@ package gqjson
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 )
 
 type JSON struct {
@@ -13,98 +17,233 @@ func NewJSON(o any) *JSON {
 	return &JSON{O: o}
 }
 
+// String pretty prints the value followed by a newline.
 func (j *JSON) String() string {
+	return j.Format(Options{})
+}
+
+// Options control how Format prints a value.
+type Options struct {
+	// Colors colorizes the output with ANSI escape sequences when set.
+	Colors *Colors
+	// ASCII escapes all non-ASCII characters in strings.
+	ASCII bool
+	// Seq prefixes the value with an RS, as in RFC 7464 JSON text sequences.
+	Seq bool
+}
+
+// Format pretty prints the value followed by a newline.
+func (j *JSON) Format(opts Options) string {
+	p := printer{colors: opts.Colors, ascii: opts.ASCII}
+	if opts.Seq {
+		p.sb.WriteRune(RS)
+	}
+	p.value(j.O, 0)
+	p.sb.WriteRune('\n')
+	return p.sb.String()
+}
+
+// Compact encodes the value on a single line, with object keys in order. It
+// is used for error messages and string conversions.
+func (j *JSON) Compact() string {
 	sb := strings.Builder{}
-	switch s := j.O.(type) {
-	case map[string]any:
-		sb.WriteString(printObj(s, 0))
-	case []any:
-		sb.WriteString(printList(s, 0))
-	case int64:
-		fmt.Fprintf(&sb, "%d", s)
+	writeCompact(&sb, j.O)
+	return sb.String()
+}
+
+func writeCompact(sb *strings.Builder, o any) {
+	switch o := o.(type) {
+	case nil:
+		sb.WriteString("null")
 	case bool:
-		fmt.Fprintf(&sb, "%t", s)
+		sb.WriteString(strconv.FormatBool(o))
+	case int64:
+		sb.WriteString(strconv.FormatInt(o, 10))
+	case int:
+		sb.WriteString(strconv.Itoa(o))
 	case float64:
-		fmt.Fprintf(&sb, "%0.2f", s)
+		sb.WriteString(formatFloat(o))
 	case string:
-		fmt.Fprintf(&sb, "\"%s\"", s)
+		writeString(sb, o, false)
+	case []any:
+		sb.WriteRune('[')
+		for i, it := range o {
+			if i > 0 {
+				sb.WriteRune(',')
+			}
+			writeCompact(sb, it)
+		}
+		sb.WriteRune(']')
+	case *Object:
+		sb.WriteRune('{')
+		for i, k := range o.Keys() {
+			if i > 0 {
+				sb.WriteRune(',')
+			}
+			v, _ := o.Get(k)
+			writeString(sb, k, false)
+			sb.WriteRune(':')
+			writeCompact(sb, v)
+		}
+		sb.WriteRune('}')
+	}
+}
+
+// formatFloat prints the shortest representation that reads back as f, using
+// an exponent only for very large or small magnitudes like jq does. JSON has
+// no infinities or NaN, so those become the largest double and null.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "null"
+	case math.IsInf(f, 1):
+		return "1.7976931348623157e+308"
+	case math.IsInf(f, -1):
+		return "-1.7976931348623157e+308"
 	}
-	sb.WriteRune('\n')
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	if exp < -4 || exp >= 17 {
+		return e
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func quote(s string, ascii bool) string {
+	sb := strings.Builder{}
+	writeString(&sb, s, ascii)
 	return sb.String()
 }
 
+// writeString writes s as a JSON string. Control characters are always
+// escaped, and with ascii so is everything outside of ASCII, using UTF-16
+// surrogate pairs above the BMP.
+func writeString(sb *strings.Builder, s string, ascii bool) {
+	sb.WriteRune('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(sb, `\u%04x`, r)
+				continue
+			}
+			if ascii && r > 0x7f {
+				if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+					fmt.Fprintf(sb, `\u%04x\u%04x`, r1, r2)
+				} else {
+					fmt.Fprintf(sb, `\u%04x`, r)
+				}
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteRune('"')
+}
+
 const ident = 2
 
-// FIXME: fix performance issue with string append
-func printList(l []any, level int) string {
-	s := "[\n"
-	for i, it := range l {
-		for range (level + 1) * ident {
-			s += " "
-		}
-		switch it := it.(type) {
-		case string:
-			s += fmt.Sprintf("\"%s\"", it)
-		case int, int16, int32, int64, int8:
-			s += fmt.Sprintf("%d", it)
-		case float64, float32:
-			s += fmt.Sprintf("%f", it)
-		case bool:
-			s += fmt.Sprintf("%t", it)
-		case map[string]any:
-			s += printObj(it, level+1)
-		case []any:
-			s += printList(it, level+1)
-		}
-		if i < len(l)-1 {
-			s += ","
-		}
-		s += "\n"
+type printer struct {
+	sb     strings.Builder
+	colors *Colors
+	ascii  bool
+}
+
+// write writes s in the given color, if colors are enabled.
+func (p *printer) write(color, s string) {
+	if p.colors == nil {
+		p.sb.WriteString(s)
+		return
 	}
+	p.sb.WriteString("\x1b[" + color + "m" + s + "\x1b[0m")
+}
+
+func (p *printer) indent(level int) {
 	for range level * ident {
-		s += " "
+		p.sb.WriteRune(' ')
 	}
-	s += "]"
-	return s
 }
 
-func printObj(obj map[string]any, level int) string {
-	s := ""
-	s += "{\n"
-
-	i := 0
-	n := len(obj)
-
-	for k, v := range obj {
-		for range (level + 1) * ident {
-			s += " "
-		}
-		s += fmt.Sprintf("\"%s\": ", k)
-		switch v := v.(type) {
-		case string:
-			s += fmt.Sprintf("\"%s\"", v)
-		case int, int16, int32, int64, int8:
-			s += fmt.Sprintf("%d", v)
-		case float32, float64:
-			s += fmt.Sprintf("%.2f", v)
-		case bool:
-			s += fmt.Sprintf("%t", v)
-		case map[string]any:
-			s += printObj(v, level+1)
-		case []any:
-			s += printList(v, level+1)
-		}
-		i++
-		if i < n {
-			s += ","
+func (p *printer) value(o any, level int) {
+	var c Colors
+	if p.colors != nil {
+		c = *p.colors
+	}
+	switch o := o.(type) {
+	case nil:
+		p.write(c.Null, "null")
+	case bool:
+		if o {
+			p.write(c.True, "true")
+		} else {
+			p.write(c.False, "false")
 		}
-		s += "\n"
+	case int, int16, int32, int64, int8:
+		p.write(c.Numbers, fmt.Sprintf("%d", o))
+	case float64:
+		p.write(c.Numbers, formatFloat(o))
+	case string:
+		p.write(c.Strings, quote(o, p.ascii))
+	case []any:
+		p.list(o, level, c.Arrays)
+	case *Object:
+		p.object(o, level, c)
 	}
+}
 
-	for range level * ident {
-		s += " "
+func (p *printer) list(l []any, level int, color string) {
+	if len(l) == 0 {
+		p.write(color, "[]")
+		return
+	}
+	p.write(color, "[")
+	p.sb.WriteRune('\n')
+	for i, it := range l {
+		p.indent(level + 1)
+		p.value(it, level+1)
+		if i < len(l)-1 {
+			p.write(color, ",")
+		}
+		p.sb.WriteRune('\n')
 	}
+	p.indent(level)
+	p.write(color, "]")
+}
 
-	s += "}"
-	return s
+func (p *printer) object(obj *Object, level int, c Colors) {
+	if obj.Len() == 0 {
+		p.write(c.Objects, "{}")
+		return
+	}
+	p.write(c.Objects, "{")
+	p.sb.WriteRune('\n')
+	i := 0
+	for k, v := range obj.All() {
+		p.indent(level + 1)
+		p.write(c.ObjectKeys, quote(k, p.ascii))
+		p.write(c.Objects, ":")
+		p.sb.WriteRune(' ')
+		p.value(v, level+1)
+		i++
+		if i < obj.Len() {
+			p.write(c.Objects, ",")
+		}
+		p.sb.WriteRune('\n')
+	}
+	p.indent(level)
+	p.write(c.Objects, "}")
 }
@@ -0,0 +1,59 @@
+package gqjson
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatStrings(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		o     any
+		ascii bool
+		out   string
+	}{
+		{desc: "unicode kept", o: "é😀", out: "\"é😀\"\n"},
+		{desc: "ascii escapes", o: "aé😀", ascii: true, out: `"a\u00e9\ud83d\ude00"` + "\n"},
+		{desc: "control characters", o: []any{"\x00\x1f\x7f\n"}, out: "[\n  \"\\u0000\\u001f\\u007f\\n\"\n]\n"},
+		{desc: "object keys", o: ObjectOf("ü\x01", "ok"), ascii: true, out: "{\n  \"\\u00fc\\u0001\": \"ok\"\n}\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := NewJSON(tC.o).Format(Options{ASCII: tC.ascii}); got != tC.out {
+				t.Fatalf("expected %q, got %q", tC.out, got)
+			}
+		})
+	}
+}
+
+func TestFormatSeq(t *testing.T) {
+	if got := NewJSON(int64(1)).Format(Options{Seq: true}); got != "\x1e1\n" {
+		t.Fatalf("expected RS prefixed value, got %q", got)
+	}
+}
+
+func TestCompactNumbers(t *testing.T) {
+	testCases := []struct {
+		desc string
+		o    any
+		out  string
+	}{
+		{desc: "integer", o: int64(-42), out: "-42"},
+		{desc: "whole float", o: float64(3), out: "3"},
+		{desc: "shortest float", o: 2.0 / 3, out: "0.6666666666666666"},
+		{desc: "large float", o: 1e16, out: "10000000000000000"},
+		{desc: "exponent", o: 1e17, out: "1e+17"},
+		{desc: "small float", o: 0.0001, out: "0.0001"},
+		{desc: "small exponent", o: 0.00001, out: "1e-05"},
+		{desc: "infinity", o: math.Inf(-1), out: "-1.7976931348623157e+308"},
+		{desc: "nan", o: math.NaN(), out: "null"},
+		{desc: "nested", o: []any{1.5, ObjectOf("a", 2.0)}, out: `[1.5,{"a":2}]`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := NewJSON(tC.o).Compact(); got != tC.out {
+				t.Fatalf("expected %s, got %s", tC.out, got)
+			}
+		})
+	}
+}
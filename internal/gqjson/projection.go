@@ -0,0 +1,195 @@
+package gqjson
+
+import (
+	"bufio"
+)
+
+type each struct{}
+
+// Each is the path element standing for every element of an array and every
+// value of an object.
+var Each = each{}
+
+// Projection selects the parts of a value that are decoded, everything else
+// is skipped without being built. Objects keep only the selected keys and
+// arrays keep their length, with null in place of the skipped elements, so
+// that types, lengths and negative indices still hold. Scalars are always
+// decoded in full. A nil *Projection selects the whole value.
+type Projection struct {
+	keys    map[string]*Projection
+	indexes map[int]*Projection
+	// each is merged into keys and indexes, which therefore never select
+	// less than it
+	each    *Projection
+	hasEach bool
+}
+
+// NewProjection returns a Projection selecting no more than the type of the
+// value.
+func NewProjection() *Projection {
+	return &Projection{}
+}
+
+// Include returns p extended with the whole value at path, whose elements
+// are keys, non-negative indices or Each. Any other element makes it select
+// the whole value.
+func (p *Projection) Include(path []any) *Projection {
+	if p == nil || len(path) == 0 {
+		return nil
+	}
+	switch k := path[0].(type) {
+	case string:
+		if p.keys == nil {
+			p.keys = map[string]*Projection{}
+		}
+		c, ok := p.keys[k]
+		p.keys[k] = p.child(c, ok, path[1:])
+	case int:
+		if p.indexes == nil {
+			p.indexes = map[int]*Projection{}
+		}
+		c, ok := p.indexes[k]
+		p.indexes[k] = p.child(c, ok, path[1:])
+	case each:
+		if p.hasEach {
+			p.each = p.each.Include(path[1:])
+		} else {
+			p.each, p.hasEach = NewProjection().Include(path[1:]), true
+		}
+		for k, c := range p.keys {
+			p.keys[k] = c.Include(path[1:])
+		}
+		for i, c := range p.indexes {
+			p.indexes[i] = c.Include(path[1:])
+		}
+	default:
+		// not a path element: select everything rather than too little
+		return nil
+	}
+	return p
+}
+
+// child extends the selection c of a key or index with rest. A key or index
+// that was not selected yet starts from what Each selects.
+func (p *Projection) child(c *Projection, exists bool, rest []any) *Projection {
+	if !exists {
+		c = NewProjection()
+		if p.hasEach {
+			c = p.each.clone()
+		}
+	}
+	return c.Include(rest)
+}
+
+func (p *Projection) clone() *Projection {
+	if p == nil {
+		return nil
+	}
+	out := &Projection{each: p.each.clone(), hasEach: p.hasEach}
+	if p.keys != nil {
+		out.keys = make(map[string]*Projection, len(p.keys))
+		for k, c := range p.keys {
+			out.keys[k] = c.clone()
+		}
+	}
+	if p.indexes != nil {
+		out.indexes = make(map[int]*Projection, len(p.indexes))
+		for i, c := range p.indexes {
+			out.indexes[i] = c.clone()
+		}
+	}
+	return out
+}
+
+func (p *Projection) key(k string) (*Projection, bool) {
+	if c, ok := p.keys[k]; ok {
+		return c, true
+	}
+	return p.each, p.hasEach
+}
+
+func (p *Projection) index(i int) (*Projection, bool) {
+	if c, ok := p.indexes[i]; ok {
+		return c, true
+	}
+	return p.each, p.hasEach
+}
+
+// DecodeProjection reads the next value, building only what p selects.
+func (t *Tokenizer) DecodeProjection(p *Projection) (any, error) {
+	tok, err := t.Next()
+	if err != nil {
+		return nil, err
+	}
+	return t.project(tok, p)
+}
+
+// project builds the parts of the value starting with tok that p selects.
+func (t *Tokenizer) project(tok Token, p *Projection) (any, error) {
+	if p == nil {
+		return t.decode(tok)
+	}
+	switch tok.Kind {
+	case BeginArray:
+		out := []any{}
+		for i := 0; ; i++ {
+			c, ok := p.index(i)
+			if !ok {
+				first, err := t.skipValue()
+				if err != nil {
+					return nil, err
+				}
+				if first.Kind == EndArray {
+					return out, nil
+				}
+				out = append(out, nil)
+				continue
+			}
+			tok, err := t.Next()
+			if err != nil {
+				return nil, err
+			}
+			if tok.Kind == EndArray {
+				return out, nil
+			}
+			v, err := t.project(tok, c)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	case BeginObject:
+		out := NewObject(0)
+		for {
+			tok, err := t.Next()
+			if err != nil {
+				return nil, err
+			}
+			if tok.Kind == EndObject {
+				return out, nil
+			}
+			key := tok.Value.(string)
+			c, ok := p.key(key)
+			if !ok {
+				if err := t.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if tok, err = t.Next(); err != nil {
+				return nil, err
+			}
+			v, err := t.project(tok, c)
+			if err != nil {
+				return nil, err
+			}
+			out.Set(key, v)
+		}
+	}
+	return tok.Value, nil
+}
+
+// ParseProjectedValue is ParseValue building only what p selects.
+func ParseProjectedValue(r *bufio.Reader, p *Projection) (any, error) {
+	return NewTokenizer(r).DecodeProjection(p)
+}
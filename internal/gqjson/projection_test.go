@@ -0,0 +1,75 @@
+package gqjson
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProjectedValue(t *testing.T) {
+	input := `{"a": {"b": 1, "c": [1, 2]}, "d": [{"e": 1, "f": "x"}, {"e": 2}, 3], "g": "skipped"}`
+	testCases := []struct {
+		desc  string
+		paths [][]any
+		want  any
+	}{
+		{
+			desc: "nothing but the type",
+			want: ObjectOf(),
+		},
+		{
+			desc:  "nested key",
+			paths: [][]any{{"a", "b"}},
+			want:  ObjectOf("a", ObjectOf("b", int64(1))),
+		},
+		{
+			desc:  "array keeps its length",
+			paths: [][]any{{"d", 1}},
+			want:  ObjectOf("d", []any{nil, ObjectOf("e", int64(2)), nil}),
+		},
+		{
+			desc:  "every element",
+			paths: [][]any{{"d", Each, "e"}, {"d", 0, "f"}},
+			want: ObjectOf(
+				"d", []any{
+					ObjectOf("e", int64(1), "f", "x"),
+					ObjectOf("e", int64(2)),
+					int64(3),
+				},
+			),
+		},
+		{
+			desc:  "unknown element selects the whole value",
+			paths: [][]any{{"a", 1.5}},
+			want:  ObjectOf("a", ObjectOf("b", int64(1), "c", []any{int64(1), int64(2)})),
+		},
+		{
+			desc:  "whole subtree",
+			paths: [][]any{{"a"}, {"a", "b"}},
+			want:  ObjectOf("a", ObjectOf("b", int64(1), "c", []any{int64(1), int64(2)})),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := NewProjection()
+			for _, path := range tC.paths {
+				p = p.Include(path)
+			}
+			got, err := ParseProjectedValue(bufio.NewReader(strings.NewReader(input)), p)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestParseProjectedValueInvalid(t *testing.T) {
+	_, err := ParseProjectedValue(bufio.NewReader(strings.NewReader(`{"a": 1, "b": [tru]}`)), NewProjection().Include([]any{"a"}))
+	if err == nil || !strings.Contains(err.Error(), "failed closing bool") {
+		t.Fatalf("expected skipped values to be validated, got: %v", err)
+	}
+}
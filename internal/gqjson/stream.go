@@ -0,0 +1,98 @@
+package gqjson
+
+import "bufio"
+
+// frame is a container that is open in a StreamParser.
+type frame struct {
+	array bool
+	// key is the index or key of the element being read
+	key any
+	// started is set once the first element was seen
+	started bool
+}
+
+// StreamParser reads JSON values as the events of jq's --stream mode, without
+// ever holding more than one scalar of them in memory. Every leaf yields a
+// [path, leaf] event, where empty arrays and objects count as leaves, and
+// every other container is closed by a [path] event holding the path of its
+// last element.
+type StreamParser struct {
+	t     *Tokenizer
+	stack []frame
+	// pending is a token that was read ahead to find out whether a
+	// container is empty
+	pending *Token
+}
+
+// NewStreamParser returns a StreamParser reading from r.
+func NewStreamParser(r *bufio.Reader) *StreamParser {
+	return &StreamParser{t: NewTokenizer(r)}
+}
+
+// Path returns the path of the value being read, which after an error is
+// where the input went wrong.
+func (p *StreamParser) Path() []any {
+	path := make([]any, 0, len(p.stack))
+	for _, f := range p.stack {
+		if f.started {
+			path = append(path, f.key)
+		}
+	}
+	return path
+}
+
+func (p *StreamParser) next() (Token, error) {
+	if p.pending != nil {
+		tok := *p.pending
+		p.pending = nil
+		return tok, nil
+	}
+	return p.t.Next()
+}
+
+// Next returns the next event, or io.EOF once r holds no more values.
+func (p *StreamParser) Next() ([]any, error) {
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.Kind {
+		case Key:
+			top := &p.stack[len(p.stack)-1]
+			top.key, top.started = tok.Value, true
+			continue
+		case EndArray, EndObject:
+			ev := []any{p.Path()}
+			p.stack = p.stack[:len(p.stack)-1]
+			return ev, nil
+		}
+
+		if n := len(p.stack); n > 0 && p.stack[n-1].array {
+			top := &p.stack[n-1]
+			if top.started {
+				top.key = top.key.(int64) + 1
+			} else {
+				top.key, top.started = int64(0), true
+			}
+		}
+		switch tok.Kind {
+		case BeginArray, BeginObject:
+			after, err := p.t.Next()
+			if err != nil {
+				return nil, err
+			}
+			if after.Kind == EndArray {
+				return []any{p.Path(), []any{}}, nil
+			}
+			if after.Kind == EndObject {
+				return []any{p.Path(), NewObject(0)}, nil
+			}
+			p.pending = &after
+			p.stack = append(p.stack, frame{array: tok.Kind == BeginArray})
+			continue
+		}
+		return []any{p.Path(), tok.Value}, nil
+	}
+}
@@ -0,0 +1,80 @@
+package gqjson
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamParser(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		input  string
+		events []any
+	}{
+		{
+			desc:   "scalars",
+			input:  `1 "a" null`,
+			events: []any{[]any{[]any{}, int64(1)}, []any{[]any{}, "a"}, []any{[]any{}, nil}},
+		},
+		{
+			desc:  "nested",
+			input: `{"a": 1, "b": [true, {"c": 2.5}]}`,
+			events: []any{
+				[]any{[]any{"a"}, int64(1)},
+				[]any{[]any{"b", int64(0)}, true},
+				[]any{[]any{"b", int64(1), "c"}, 2.5},
+				[]any{[]any{"b", int64(1), "c"}},
+				[]any{[]any{"b", int64(1)}},
+				[]any{[]any{"b"}},
+			},
+		},
+		{
+			desc:  "empty containers are leaves",
+			input: `[] {"a": {}, "b": [ ]}`,
+			events: []any{
+				[]any{[]any{}, []any{}},
+				[]any{[]any{"a"}, ObjectOf()},
+				[]any{[]any{"b"}, []any{}},
+				[]any{[]any{"b"}},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := NewStreamParser(bufio.NewReader(strings.NewReader(tC.input)))
+			var got []any
+			for {
+				ev, err := p.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected no error, instead got: %v", err)
+				}
+				got = append(got, ev)
+			}
+			if !reflect.DeepEqual(got, tC.events) {
+				t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, tC.events)
+			}
+		})
+	}
+}
+
+func TestStreamParserError(t *testing.T) {
+	p := NewStreamParser(bufio.NewReader(strings.NewReader(`{"a": [1, 2 3]}`)))
+	for i := 0; i < 2; i++ {
+		if _, err := p.Next(); err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+	}
+	_, err := p.Next()
+	if err == nil || !strings.Contains(err.Error(), "unclosed array") {
+		t.Fatalf("expected unclosed array error, got: %v", err)
+	}
+	if want := []any{"a", int64(1)}; !reflect.DeepEqual(p.Path(), want) {
+		t.Fatalf("expected path %v, got %v", want, p.Path())
+	}
+}
@@ -0,0 +1,320 @@
+package gqjson
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TokenKind is the kind of a Token.
+type TokenKind int
+
+const (
+	BeginObject TokenKind = iota
+	EndObject
+	BeginArray
+	EndArray
+	// Key is an object key, always followed by the tokens of its value.
+	Key
+	// Value is a scalar: a string, number, boolean or null.
+	Value
+)
+
+var tokenKinds = [...]string{"begin-object", "end-object", "begin-array", "end-array", "key", "value"}
+
+func (k TokenKind) String() string {
+	return tokenKinds[k]
+}
+
+// Token is a piece of JSON text returned by a Tokenizer.
+type Token struct {
+	Kind TokenKind
+	// Value holds the key of Key tokens and the value of Value tokens. It
+	// is left nil for values that were skipped.
+	Value any
+	// Offset is the position of the first byte of the token in the input.
+	Offset int64
+}
+
+// what a Tokenizer expects next
+type tokenizerState int
+
+const (
+	expectValue tokenizerState = iota
+	// first element of an array, or its end
+	expectElement
+	// first key of an object, or its end
+	expectFirstKey
+	expectKey
+	// a comma or the end of the innermost container
+	expectNext
+)
+
+// Tokenizer is a pull parser yielding the tokens of a series of JSON values
+// one at a time, without building any tree. The value parsers, --stream and
+// selective decoding are all built on it.
+type Tokenizer struct {
+	r *reader
+	// stack holds BeginArray or BeginObject for every open container
+	stack []TokenKind
+	state tokenizerState
+	// skip makes scalars be validated but not built
+	skip bool
+}
+
+// NewTokenizer returns a Tokenizer reading from r.
+func NewTokenizer(r *bufio.Reader) *Tokenizer {
+	return &Tokenizer{r: &reader{r: r}}
+}
+
+// Depth returns the number of containers that are open.
+func (t *Tokenizer) Depth() int {
+	return len(t.stack)
+}
+
+// Next returns the next token. It returns io.EOF when the input ends between
+// two values, while any other end is an error.
+func (t *Tokenizer) Next() (Token, error) {
+	for {
+		ch, err := readToken(t.r)
+		offset := t.r.off - int64(t.r.last)
+		if err != nil {
+			if len(t.stack) == 0 && err == io.EOF {
+				return Token{}, io.EOF
+			}
+			return Token{}, t.errorf("%v", err)
+		}
+
+		switch t.state {
+		case expectElement:
+			if ch == ']' {
+				return t.end(EndArray, offset), nil
+			}
+		case expectFirstKey:
+			if ch == '}' {
+				return t.end(EndObject, offset), nil
+			}
+			return t.key(ch, offset)
+		case expectKey:
+			return t.key(ch, offset)
+		case expectNext:
+			top := t.stack[len(t.stack)-1]
+			switch {
+			case ch == ',' && top == BeginArray:
+				t.state = expectValue
+				continue
+			case ch == ',':
+				t.state = expectKey
+				continue
+			case ch == ']' && top == BeginArray:
+				return t.end(EndArray, offset), nil
+			case ch == '}' && top == BeginObject:
+				return t.end(EndObject, offset), nil
+			}
+			return Token{}, t.errorf("unexpected %q", ch)
+		}
+		return t.value(ch, offset)
+	}
+}
+
+// errorf reports an error in the words of the innermost container.
+func (t *Tokenizer) errorf(format string, args ...any) error {
+	prefix := "failed parsing value"
+	if n := len(t.stack); n > 0 && t.stack[n-1] == BeginArray {
+		prefix = "unclosed array"
+	} else if n > 0 {
+		prefix = "invalid object"
+	}
+	return fmt.Errorf(prefix+": "+format, args...)
+}
+
+func (t *Tokenizer) end(kind TokenKind, offset int64) Token {
+	t.stack = t.stack[:len(t.stack)-1]
+	t.done()
+	return Token{Kind: kind, Offset: offset}
+}
+
+// done moves on after a complete value.
+func (t *Tokenizer) done() {
+	t.state = expectValue
+	if len(t.stack) > 0 {
+		t.state = expectNext
+	}
+}
+
+func (t *Tokenizer) key(ch rune, offset int64) (Token, error) {
+	if ch != '"' {
+		return Token{}, t.errorf("unexpected %q, expected a key", ch)
+	}
+	key, err := parseString(t.r)
+	if err != nil {
+		return Token{}, err
+	}
+	if ch, err = readToken(t.r); err != nil || ch != ':' {
+		return Token{}, t.errorf("expected : after key %q", key)
+	}
+	t.state = expectValue
+	return Token{Kind: Key, Value: key, Offset: offset}, nil
+}
+
+func (t *Tokenizer) value(ch rune, offset int64) (Token, error) {
+	switch ch {
+	case '{':
+		t.stack = append(t.stack, BeginObject)
+		t.state = expectFirstKey
+		return Token{Kind: BeginObject, Offset: offset}, nil
+	case '[':
+		t.stack = append(t.stack, BeginArray)
+		t.state = expectElement
+		return Token{Kind: BeginArray, Offset: offset}, nil
+	}
+
+	v, err := parseScalar(ch, t.r, t.skip)
+	var unexpected errUnexpected
+	if errors.As(err, &unexpected) {
+		return Token{}, t.errorf("%v", err)
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	t.done()
+	return Token{Kind: Value, Value: v, Offset: offset}, nil
+}
+
+// Decode reads the next value and builds it.
+func (t *Tokenizer) Decode() (any, error) {
+	tok, err := t.Next()
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(tok)
+}
+
+// decode builds the value that starts with tok.
+func (t *Tokenizer) decode(tok Token) (any, error) {
+	switch tok.Kind {
+	case BeginArray:
+		out := []any{}
+		for {
+			tok, err := t.Next()
+			if err != nil {
+				return nil, err
+			}
+			if tok.Kind == EndArray {
+				return out, nil
+			}
+			v, err := t.decode(tok)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	case BeginObject:
+		out := NewObject(0)
+		for {
+			tok, err := t.Next()
+			if err != nil {
+				return nil, err
+			}
+			if tok.Kind == EndObject {
+				return out, nil
+			}
+			key := tok.Value.(string)
+			if tok, err = t.Next(); err != nil {
+				return nil, err
+			}
+			v, err := t.decode(tok)
+			if err != nil {
+				return nil, err
+			}
+			out.Set(key, v)
+		}
+	}
+	return tok.Value, nil
+}
+
+// Skip reads past the next value, validating it without building anything.
+func (t *Tokenizer) Skip() error {
+	first, err := t.skipValue()
+	if err == nil && first.Kind != BeginArray && first.Kind != BeginObject && first.Kind != Value {
+		return fmt.Errorf("unexpected %s, expected a value", first.Kind)
+	}
+	return err
+}
+
+// skipValue reads past the next value and returns its first token. When
+// the innermost container ends instead, only its end token is read.
+func (t *Tokenizer) skipValue() (Token, error) {
+	t.skip = true
+	defer func() { t.skip = false }()
+
+	var first Token
+	for depth := 0; ; {
+		tok, err := t.Next()
+		if err != nil {
+			return first, err
+		}
+		if depth == 0 {
+			first = tok
+		}
+		switch tok.Kind {
+		case BeginArray, BeginObject:
+			depth++
+		case EndArray, EndObject:
+			depth--
+		case Key:
+			continue
+		}
+		if depth <= 0 {
+			return first, nil
+		}
+	}
+}
+
+// reader counts the bytes consumed from a bufio.Reader, for token offsets.
+type reader struct {
+	r   *bufio.Reader
+	off int64
+	// last is the size of the last rune read
+	last int
+}
+
+func (r *reader) ReadRune() (rune, int, error) {
+	ch, size, err := r.r.ReadRune()
+	r.off += int64(size)
+	r.last = size
+	return ch, size, err
+}
+
+func (r *reader) UnreadRune() error {
+	err := r.r.UnreadRune()
+	if err == nil {
+		r.off -= int64(r.last)
+	}
+	return err
+}
+
+func (r *reader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.off++
+	}
+	return b, err
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *reader) Peek(n int) ([]byte, error) {
+	return r.r.Peek(n)
+}
+
+func (r *reader) Discard(n int) (int, error) {
+	n, err := r.r.Discard(n)
+	r.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,82 @@
+package gqjson
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	tok := NewTokenizer(bufio.NewReader(strings.NewReader(`{"a": [1, "é"], "b": {}} null`)))
+	want := []Token{
+		{Kind: BeginObject, Offset: 0},
+		{Kind: Key, Value: "a", Offset: 1},
+		{Kind: BeginArray, Offset: 6},
+		{Kind: Value, Value: int64(1), Offset: 7},
+		{Kind: Value, Value: "é", Offset: 10},
+		{Kind: EndArray, Offset: 14},
+		{Kind: Key, Value: "b", Offset: 17},
+		{Kind: BeginObject, Offset: 22},
+		{Kind: EndObject, Offset: 23},
+		{Kind: EndObject, Offset: 24},
+		{Kind: Value, Value: nil, Offset: 26},
+	}
+	var got []Token
+	for {
+		next, err := tok.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		got = append(got, next)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, want)
+	}
+}
+
+func TestTokenizerSkip(t *testing.T) {
+	tok := NewTokenizer(bufio.NewReader(strings.NewReader(`{"skip": {"x": ["a\"]", [{}]]}, "keep": [1]} 2`)))
+	var got []any
+	for {
+		next, err := tok.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		switch {
+		case next.Kind == Key && next.Value == "skip":
+			if err := tok.Skip(); err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+		case next.Kind == Key:
+			v, err := tok.Decode()
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			got = append(got, v)
+		case next.Kind == Value:
+			got = append(got, next.Value)
+		}
+	}
+	want := []any{[]any{int64(1)}, int64(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, want)
+	}
+}
+
+func TestTokenizerSkipEnd(t *testing.T) {
+	tok := NewTokenizer(bufio.NewReader(strings.NewReader(`[]`)))
+	if _, err := tok.Next(); err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if err := tok.Skip(); err == nil {
+		t.Fatalf("expected an error skipping the end of an array")
+	}
+}
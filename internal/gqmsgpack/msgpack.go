@@ -0,0 +1,349 @@
+// Package gqmsgpack converts between MessagePack and the values gq works on,
+// which are the same as those of gqjson.
+//
+// Integers that do not fit an int64 are read as numbers like those of JSON,
+// binary data as base64 strings and maps with keys other than strings have
+// those keys written as JSON. The timestamp extension is read as an RFC 3339
+// string in UTC, and any other extension as {"ext": type, "data": base64}.
+// Written values only use nil, booleans, integers, float64, strings, arrays
+// and maps, so binary data and extensions come back as what they were read
+// as.
+package gqmsgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// Decoder reads a series of MessagePack values one at a time.
+type Decoder struct {
+	r *bufio.Reader
+	// depth is the number of values being read, one inside the other
+	depth int
+}
+
+// maxDepth bounds how deeply values may be nested, like the YAML parser, so that
+// hostile input cannot exhaust the stack.
+const maxDepth = 10000
+
+var errDepth = errors.New("too deeply nested")
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br}
+}
+
+// Next returns the next value, or io.EOF after the last one.
+func (d *Decoder) Next() (any, error) {
+	if _, err := d.r.Peek(1); err == io.EOF {
+		return nil, io.EOF
+	}
+	v, err := d.value()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid MessagePack: %w", err)
+	}
+	return v, nil
+}
+
+func (d *Decoder) value() (any, error) {
+	if d.depth >= maxDepth {
+		return nil, errDepth
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.mapping(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.array(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.str(uint64(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (b - 0xcc))
+		if n > math.MaxInt64 {
+			return float64(n), err
+		}
+		return int64(n), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := d.uint(size)
+		// sign extend from the size of the integer
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapping(int(n))
+	}
+	return nil, fmt.Errorf("unknown type byte 0x%02x", b)
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *Decoder) uint(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// bytes reads n bytes. The buffer grows as they are read, so that a wrong
+// length does not allocate more than the input holds.
+func (d *Decoder) bytes(n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if n > math.MaxInt64 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *Decoder) str(n uint64) (any, error) {
+	b, err := d.bytes(n)
+	return string(b), err
+}
+
+func (d *Decoder) array(n int) (any, error) {
+	out := make([]any, 0, min(n, 1024))
+	for range n {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *Decoder) mapping(n int) (any, error) {
+	out := gqjson.NewObject(min(n, 1024))
+	for range n {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = gqjson.NewJSON(k).Compact()
+		}
+		out.Set(key, v)
+	}
+	return out, nil
+}
+
+// timestampExt is the type of the timestamp extension.
+const timestampExt = -1
+
+// ext reads an extension whose data has n bytes.
+func (d *Decoder) ext(n uint64) (any, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) == timestampExt {
+		if t, ok := timestamp(data); ok {
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+		return nil, fmt.Errorf("invalid timestamp of %d bytes", len(data))
+	}
+	return gqjson.ObjectOf(
+		"ext", int64(int8(typ)),
+		"data", base64.StdEncoding.EncodeToString(data),
+	), nil
+}
+
+// timestamp decodes the 32, 64 and 96 bit forms of the timestamp extension.
+func timestamp(data []byte) (time.Time, bool) {
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), true
+	case 8:
+		n := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(n&(1<<34-1)), int64(n>>34)), true
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)), true
+	}
+	return time.Time{}, false
+}
+
+// Format returns v as MessagePack, in a string of bytes like those of the
+// other formats. Integers take the smallest encoding and map keys keep
+// their order.
+func Format(v any) (string, error) {
+	var buf bytes.Buffer
+	encode(&buf, v)
+	return buf.String(), nil
+}
+
+func encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int64:
+		encodeInt(buf, v)
+	case float64:
+		buf.WriteByte(0xcb)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+		default:
+			buf.WriteByte(0xdb)
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+		}
+		buf.WriteString(v)
+	case []any:
+		header(buf, len(v), 0x90, 0xdc)
+		for _, e := range v {
+			encode(buf, e)
+		}
+	case *gqjson.Object:
+		header(buf, v.Len(), 0x80, 0xde)
+		for k, e := range v.All() {
+			encode(buf, k)
+			encode(buf, e)
+		}
+	default:
+		panic(fmt.Sprintf("gqmsgpack: unsupported value %T", v))
+	}
+}
+
+// header writes the length of an array or map: fix is the type byte of the
+// short form and long the one of the 16 bit form, followed by the 32 bit one.
+func header(buf *bytes.Buffer, n int, fix, long byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(long)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(long + 1)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func encodeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f, i < 0 && i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(i)})
+	case i >= 0 && i <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= 0 && i <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	case i >= 0:
+		buf.WriteByte(0xcf)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	case i >= math.MinInt8:
+		buf.Write([]byte{0xd0, byte(i)})
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
@@ -0,0 +1,116 @@
+package gqmsgpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+func decodeHex(t *testing.T, s string) (any, error) {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid test input: %v", err)
+	}
+	return NewDecoder(bytes.NewReader(b)).Next()
+}
+
+func TestDecoder(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+		want  any
+	}{
+		{desc: "fixint", input: "07", want: int64(7)},
+		{desc: "negative fixint", input: "ff", want: int64(-1)},
+		{desc: "int16", input: "d1ff38", want: int64(-200)},
+		{desc: "uint64 overflow", input: "cfffffffffffffffff", want: 18446744073709551615.0},
+		{desc: "float32", input: "ca3fc00000", want: 1.5},
+		{desc: "str8", input: "d903616263", want: "abc"},
+		{desc: "bin", input: "c403010203", want: "AQID"},
+		{desc: "map with int key", input: "8101a178", want: gqjson.ObjectOf("1", "x")},
+		{desc: "array", input: "92c0c3", want: []any{nil, true}},
+		{desc: "ext", input: "d40563", want: gqjson.ObjectOf("ext", int64(5), "data", "Yw==")},
+		{desc: "timestamp32", input: "d6ff00000001", want: "1970-01-01T00:00:01Z"},
+		{desc: "timestamp64", input: "d7ff0000000400000002", want: "1970-01-01T00:00:02.000000001Z"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := decodeHex(t, tC.input)
+			if err != nil {
+				t.Fatalf("expected no error, instead got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("failed comparison\ngot: %#v\nexpected: %#v\n", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	testCases := []struct {
+		desc, input, err string
+	}{
+		{desc: "truncated", input: "92c0", err: "unexpected EOF"},
+		{desc: "never used", input: "c1", err: "unknown type byte 0xc1"},
+		{desc: "bad timestamp", input: "d5ff0000", err: "invalid timestamp"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := decodeHex(t, tC.input)
+			if err == nil || !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
+
+func TestDecoderDepth(t *testing.T) {
+	deep := strings.Repeat("91", 2*maxDepth) + "01"
+	if _, err := decodeHex(t, deep); err == nil || err.Error() != "invalid MessagePack: too deeply nested" {
+		t.Fatalf("expected too deeply nested error, got: %v", err)
+	}
+	ok := strings.Repeat("91", maxDepth-1) + "01"
+	if _, err := decodeHex(t, ok); err != nil {
+		t.Fatalf("expected no error at depth %d, instead got: %v", maxDepth, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	values := []any{
+		nil, true, int64(0), int64(-33), int64(300), int64(-70000), int64(1) << 40,
+		1.25, strings.Repeat("x", 40), []any{}, make([]any, 20),
+		gqjson.ObjectOf("b", int64(1), "a", []any{"x"}),
+	}
+	var buf bytes.Buffer
+	for _, v := range values {
+		s, err := Format(v)
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		buf.WriteString(s)
+	}
+	d := NewDecoder(&buf)
+	for _, want := range values {
+		got, err := d.Next()
+		if err != nil {
+			t.Fatalf("expected no error, instead got: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("failed round trip\ngot: %#v\nexpected: %#v\n", got, want)
+		}
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+
+	got, _ := Format(gqjson.ObjectOf("b", int64(1), "a", nil))
+	if want := "\x82\xa1b\x01\xa1a\xc0"; got != want {
+		t.Fatalf("expected keys in order %q, got %q", want, got)
+	}
+}
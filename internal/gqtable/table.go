@@ -0,0 +1,274 @@
+// Package gqtable writes a stream of objects as a table, with a row per
+// object and a column per key.
+package gqtable
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// Table holds the rows of a table and their columns.
+type Table struct {
+	Columns []string
+	Rows    []*gqjson.Object
+}
+
+// New returns the table of the outputs of a program. Every object is a row
+// and arrays contribute their elements as rows. The columns are the union of
+// the keys, in the order they are first seen.
+func New(outputs []any) (*Table, error) {
+	t := &Table{}
+	seen := map[string]bool{}
+	var add func(v any) error
+	add = func(v any) error {
+		switch v := v.(type) {
+		case *gqjson.Object:
+			for _, k := range v.Keys() {
+				if !seen[k] {
+					t.Columns = append(t.Columns, k)
+					seen[k] = true
+				}
+			}
+			t.Rows = append(t.Rows, v)
+			return nil
+		case []any:
+			for _, e := range v {
+				if _, ok := e.(*gqjson.Object); !ok {
+					return fmt.Errorf("cannot write %s as a table row, rows must be objects", typeName(e))
+				}
+				add(e)
+			}
+			return nil
+		}
+		return fmt.Errorf("cannot write %s as a table row, rows must be objects", typeName(v))
+	}
+	for _, v := range outputs {
+		if err := add(v); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// cell returns the text of a field: strings as they are, missing fields and
+// null as nothing and anything else as compact JSON.
+func cell(row *gqjson.Object, col string) string {
+	v, _ := row.Get(col)
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return gqjson.NewJSON(v).Compact()
+	}
+}
+
+// numeric reports for every column whether it only holds numbers, which are
+// aligned to the right.
+func (t *Table) numeric() []bool {
+	found := make([]bool, len(t.Columns))
+	other := make([]bool, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, col := range t.Columns {
+			v, _ := row.Get(col)
+			switch v.(type) {
+			case int64, float64:
+				found[i] = true
+			case nil:
+			default:
+				other[i] = true
+			}
+		}
+	}
+	for i := range found {
+		found[i] = found[i] && !other[i]
+	}
+	return found
+}
+
+// cells returns the header and the rows as text, with esc applied to every
+// cell.
+func (t *Table) cells(esc func(string) string) [][]string {
+	out := make([][]string, 0, len(t.Rows)+1)
+	header := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		header[i] = esc(col)
+	}
+	out = append(out, header)
+	for _, row := range t.Rows {
+		line := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			line[i] = esc(cell(row, col))
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// widths returns the width of every column on a terminal.
+func widths(lines [][]string) []int {
+	out := make([]int, len(lines[0]))
+	for _, line := range lines {
+		for i, s := range line {
+			out[i] = max(out[i], Width(s))
+		}
+	}
+	return out
+}
+
+// pad fills s with spaces up to width, on the left if right is set.
+func pad(s string, width int, right bool) string {
+	fill := strings.Repeat(" ", width-Width(s))
+	if right {
+		return fill + s
+	}
+	return s + fill
+}
+
+var textReplacer = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// Text renders t as columns aligned with spaces, for terminals. The header
+// is underlined with dashes and numbers are aligned to the right.
+func (t *Table) Text() string {
+	if len(t.Columns) == 0 {
+		return ""
+	}
+	lines := t.cells(textReplacer.Replace)
+	w := widths(lines)
+	numeric := t.numeric()
+	var sb strings.Builder
+	write := func(line []string) {
+		parts := make([]string, len(line))
+		for i, s := range line {
+			parts[i] = pad(s, w[i], numeric[i])
+		}
+		sb.WriteString(strings.TrimRight(strings.Join(parts, "  "), " "))
+		sb.WriteByte('\n')
+	}
+	write(lines[0])
+	rule := make([]string, len(w))
+	for i := range w {
+		rule[i] = strings.Repeat("-", w[i])
+	}
+	write(rule)
+	for _, line := range lines[1:] {
+		write(line)
+	}
+	return sb.String()
+}
+
+var markdownReplacer = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// Markdown renders t as a GitHub Flavored Markdown table.
+func (t *Table) Markdown() string {
+	if len(t.Columns) == 0 {
+		return ""
+	}
+	lines := t.cells(markdownReplacer.Replace)
+	w := widths(lines)
+	numeric := t.numeric()
+	var sb strings.Builder
+	write := func(line []string) {
+		sb.WriteString("|")
+		for i, s := range line {
+			sb.WriteString(" " + pad(s, max(w[i], 3), numeric[i]) + " |")
+		}
+		sb.WriteByte('\n')
+	}
+	write(lines[0])
+	sb.WriteString("|")
+	for i := range t.Columns {
+		rule := strings.Repeat("-", max(w[i], 3))
+		if numeric[i] {
+			rule = rule[1:] + ":"
+		}
+		sb.WriteString(" " + rule + " |")
+	}
+	sb.WriteByte('\n')
+	for _, line := range lines[1:] {
+		write(line)
+	}
+	return sb.String()
+}
+
+// CSV renders t as RFC 4180 CSV with a header row. Fields are quoted when
+// needed.
+func (t *Table) CSV() (string, error) {
+	if len(t.Columns) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(t.cells(func(s string) string { return s })); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var tsvReplacer = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// TSV renders t as tab separated values with a header row, escaping
+// backslashes, tabs and line breaks like @tsv.
+func (t *Table) TSV() string {
+	var sb strings.Builder
+	for _, line := range t.cells(tsvReplacer.Replace) {
+		if len(line) == 0 {
+			break
+		}
+		sb.WriteString(strings.Join(line, "\t"))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Width returns the number of terminal cells s takes: combining marks take
+// none and wide East Asian characters and emoji take two.
+func Width(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case wide(r):
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func wide(r rune) bool {
+	return r >= 0x1100 && (r <= 0x115f ||
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f ||
+		r >= 0xac00 && r <= 0xd7a3 ||
+		r >= 0xf900 && r <= 0xfaff ||
+		r >= 0xfe30 && r <= 0xfe4f ||
+		r >= 0xff00 && r <= 0xff60 ||
+		r >= 0xffe0 && r <= 0xffe6 ||
+		r >= 0x1f300 && r <= 0x1f64f ||
+		r >= 0x1f900 && r <= 0x1f9ff ||
+		r >= 0x20000 && r <= 0x3fffd)
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case int64, float64:
+		return "a number"
+	case string:
+		return "a string"
+	}
+	return "an array"
+}
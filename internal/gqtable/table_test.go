@@ -0,0 +1,123 @@
+package gqtable
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+var outputs = []any{
+	gqjson.ObjectOf("name", "gq", "stars", int64(12)),
+	[]any{gqjson.ObjectOf("name", "日本語", "stars", 3.5, "note", "a|b\nc")},
+}
+
+func TestNew(t *testing.T) {
+	tbl, err := New(outputs)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if want := []string{"name", "stars", "note"}; !reflect.DeepEqual(tbl.Columns, want) {
+		t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", tbl.Columns, want)
+	}
+	if len(tbl.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(tbl.Rows))
+	}
+}
+
+func TestNewColumnOrder(t *testing.T) {
+	tbl, err := New([]any{
+		gqjson.ObjectOf("z", int64(1), "a", int64(2)),
+		gqjson.ObjectOf("y", int64(3), "a", int64(4), "b", int64(5)),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if want := []string{"z", "a", "y", "b"}; !reflect.DeepEqual(tbl.Columns, want) {
+		t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", tbl.Columns, want)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		outputs []any
+		err     string
+	}{
+		{desc: "scalar", outputs: []any{"x"}, err: "cannot write a string as a table row"},
+		{desc: "nested array", outputs: []any{[]any{[]any{}}}, err: "cannot write an array as a table row"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := New(tC.outputs)
+			if err == nil || !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tbl, err := New(outputs)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	csv, err := tbl.CSV()
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	testCases := []struct {
+		desc, got, want string
+	}{
+		{
+			desc: "text",
+			got:  tbl.Text(),
+			want: "name    stars  note\n" +
+				"------  -----  ------\n" +
+				"gq         12\n" +
+				"日本語    3.5  a|b\\nc\n",
+		},
+		{
+			desc: "markdown",
+			got:  tbl.Markdown(),
+			want: "| name   | stars | note      |\n" +
+				"| ------ | ----: | --------- |\n" +
+				"| gq     |    12 |           |\n" +
+				"| 日本語 |   3.5 | a\\|b<br>c |\n",
+		},
+		{
+			desc: "csv",
+			got:  csv,
+			want: "name,stars,note\ngq,12,\n日本語,3.5,\"a|b\nc\"\n",
+		},
+		{
+			desc: "tsv",
+			got:  tbl.TSV(),
+			want: "name\tstars\tnote\ngq\t12\t\n日本語\t3.5\ta|b\\nc\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if tC.got != tC.want {
+				t.Fatalf("failed comparison\ngot:\n%s\nexpected:\n%s\n", tC.got, tC.want)
+			}
+		})
+	}
+}
+
+func TestWidth(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want int
+	}{
+		{s: "abc", want: 3},
+		{s: "日本", want: 4},
+		{s: "é", want: 1},
+	}
+	for _, tC := range testCases {
+		if got := Width(tC.s); got != tC.want {
+			t.Fatalf("Width(%q) = %d, expected %d", tC.s, got, tC.want)
+		}
+	}
+}
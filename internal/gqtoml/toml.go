@@ -0,0 +1,366 @@
+// Package gqtoml converts between TOML documents and the values gq works
+// on, which are the same as those of gqjson.
+//
+// TOML datetimes have no counterpart among those values, so they are read as
+// strings in the RFC 3339 form they were written in: offset datetimes such as
+// "1979-05-27T07:32:00Z", local datetimes such as "1979-05-27T07:32:00",
+// local dates such as "1979-05-27" and local times such as "07:32:00".
+// Fractional seconds are kept. When written back, they are plain strings.
+package gqtoml
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// Decoder reads the single TOML document of a reader.
+type Decoder struct {
+	r    io.Reader
+	done bool
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Next returns the document as an object, or io.EOF once it was read.
+func (d *Decoder) Next() (any, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	d.done = true
+	m := map[string]any{}
+	md, err := toml.NewDecoder(d.r).Decode(&m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOML: %v", err)
+	}
+	return value(m, "", keyOrder(md.Keys(), m)), nil
+}
+
+// keyOrder returns the keys of every table in the order they are first seen
+// in the document, by the path of the table. Paths join keys with dots and
+// hold the index of the tables of arrays, e.g. .bin[1].
+func keyOrder(keys []toml.Key, doc map[string]any) map[string][]string {
+	order := map[string][]string{}
+	seen := map[string]bool{}
+	// tables counts the tables of the arrays of tables seen so far
+	tables := map[string]int{}
+	for _, key := range keys {
+		path := ""
+		var cur any = doc
+		for i, k := range key {
+			m, ok := cur.(map[string]any)
+			if !ok {
+				break
+			}
+			child := path + "." + strconv.Quote(k)
+			if !seen[child] {
+				seen[child] = true
+				order[path] = append(order[path], k)
+			}
+			path, cur = child, m[k]
+			if arr, ok := cur.([]map[string]any); ok {
+				// a key naming an array of tables starts its next table
+				if i == len(key)-1 {
+					tables[path]++
+				}
+				n := tables[path] - 1
+				if n < 0 || n >= len(arr) {
+					break
+				}
+				path, cur = fmt.Sprintf("%s[%d]", path, n), arr[n]
+			}
+		}
+	}
+	return order
+}
+
+// value converts a decoded TOML value found at path, with the keys of
+// tables in the given order. Keys that have none, such as those of inline
+// tables in arrays, are sorted.
+func value(v any, path string, order map[string][]string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := gqjson.NewObject(len(v))
+		for _, k := range order[path] {
+			if e, ok := v[k]; ok {
+				out.Set(k, value(e, path+"."+strconv.Quote(k), order))
+			}
+		}
+		rest := make([]string, 0, len(v)-out.Len())
+		for k := range v {
+			if _, ok := out.Get(k); !ok {
+				rest = append(rest, k)
+			}
+		}
+		sort.Strings(rest)
+		for _, k := range rest {
+			out.Set(k, value(v[k], path+"."+strconv.Quote(k), order))
+		}
+		return out
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = value(e, fmt.Sprintf("%s[%d]", path, i), order)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = value(e, fmt.Sprintf("%s[%d]", path, i), order)
+		}
+		return out
+	case time.Time:
+		return datetime(v)
+	}
+	return v
+}
+
+// datetime writes a datetime back in the form it had in the document.
+func datetime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Format prints v as a TOML document, with keys in their order except that
+// tables come after the other keys of their table, as TOML requires. Only
+// objects can be documents, and TOML has no null, so anything else is an
+// error.
+func Format(v any) (string, error) {
+	doc, ok := v.(*gqjson.Object)
+	if !ok {
+		return "", fmt.Errorf("cannot write %s as TOML, the document must be an object", typeName(v))
+	}
+	if p, ok := findNull(v, ""); ok {
+		return "", fmt.Errorf("cannot write null at %s as TOML", p)
+	}
+	var w writer
+	w.table(doc, nil)
+	return w.sb.String(), nil
+}
+
+// writer writes a TOML document. Objects are tables and arrays holding only
+// objects arrays of tables, except inside arrays and inline tables, where
+// they are written inline.
+type writer struct {
+	sb strings.Builder
+}
+
+// table writes the keys of the table at path, whose header is written. Its
+// values come first, since every key after a header belongs to that table.
+func (w *writer) table(o *gqjson.Object, path []string) {
+	for k, v := range o.All() {
+		if !isTable(v) && !isTables(v) {
+			w.sb.WriteString(key(k) + " = ")
+			w.value(v)
+			w.sb.WriteByte('\n')
+		}
+	}
+	for k, v := range o.All() {
+		p := append(path[:len(path):len(path)], k)
+		if isTable(v) {
+			w.header("[", p, "]")
+			w.table(v.(*gqjson.Object), p)
+		} else if isTables(v) {
+			for _, e := range v.([]any) {
+				w.header("[[", p, "]]")
+				w.table(e.(*gqjson.Object), p)
+			}
+		}
+	}
+}
+
+// header writes the header of a table or of a table of an array, after a
+// blank line.
+func (w *writer) header(open string, path []string, close string) {
+	if w.sb.Len() > 0 {
+		w.sb.WriteByte('\n')
+	}
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = key(k)
+	}
+	w.sb.WriteString(open + strings.Join(keys, ".") + close + "\n")
+}
+
+// value writes a value inline.
+func (w *writer) value(v any) {
+	switch v := v.(type) {
+	case bool:
+		w.sb.WriteString(strconv.FormatBool(v))
+	case int64:
+		w.sb.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		w.sb.WriteString(float(v))
+	case string:
+		w.sb.WriteString(quote(v))
+	case []any:
+		w.sb.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				w.sb.WriteString(", ")
+			}
+			w.value(e)
+		}
+		w.sb.WriteByte(']')
+	case *gqjson.Object:
+		w.sb.WriteByte('{')
+		i := 0
+		for k, e := range v.All() {
+			if i > 0 {
+				w.sb.WriteString(",")
+			}
+			w.sb.WriteString(" " + key(k) + " = ")
+			w.value(e)
+			i++
+		}
+		if i > 0 {
+			w.sb.WriteByte(' ')
+		}
+		w.sb.WriteByte('}')
+	}
+}
+
+func isTable(v any) bool {
+	_, ok := v.(*gqjson.Object)
+	return ok
+}
+
+// isTables reports whether v can be an array of tables.
+func isTables(v any) bool {
+	l, ok := v.([]any)
+	if !ok || len(l) == 0 {
+		return false
+	}
+	for _, e := range l {
+		if !isTable(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// float writes a float as gq prints it in JSON, with a fraction or an
+// exponent as TOML requires.
+func float(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := gqjson.NewJSON(f).Compact()
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func key(k string) string {
+	if bareKey.MatchString(k) {
+		return k
+	}
+	return quote(k)
+}
+
+// quote writes a basic string.
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// findNull returns the path, such as .a[0], of a null inside v.
+func findNull(v any, path string) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return path, true
+	case []any:
+		for i, e := range v {
+			if p, ok := findNull(e, fmt.Sprintf("%s[%d]", path, i)); ok {
+				return p, true
+			}
+		}
+	case *gqjson.Object:
+		for k, e := range v.All() {
+			if p, ok := findNull(e, keyPath(path, k)); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+func keyPath(path, k string) string {
+	if identifier.MatchString(k) {
+		return path + "." + k
+	}
+	if path == "" {
+		path = "."
+	}
+	return fmt.Sprintf("%s[%q]", path, k)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case int64, float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "an array"
+	}
+	return "an object"
+}
@@ -0,0 +1,151 @@
+package gqtoml
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+func TestDecoder(t *testing.T) {
+	input := `title = "gq"
+version = 3
+ratio = 0.5
+
+[dates]
+offset = 1979-05-27T07:32:00.5-07:00
+utc = 1979-05-27T07:32:00Z
+local = 1979-05-27T07:32:00
+day = 1979-05-27
+time = 07:32:00
+
+[[bin]]
+name = "gq"
+
+[[bin]]
+name = "man-gen"
+tags = ["a", 1]
+`
+	want := gqjson.ObjectOf(
+		"title", "gq",
+		"version", int64(3),
+		"ratio", 0.5,
+		"dates", gqjson.ObjectOf(
+			"offset", "1979-05-27T07:32:00.5-07:00",
+			"utc", "1979-05-27T07:32:00Z",
+			"local", "1979-05-27T07:32:00",
+			"day", "1979-05-27",
+			"time", "07:32:00",
+		),
+		"bin", []any{
+			gqjson.ObjectOf("name", "gq"),
+			gqjson.ObjectOf("name", "man-gen", "tags", []any{"a", int64(1)}),
+		},
+	)
+	d := NewDecoder(strings.NewReader(input))
+	got, err := d.Next()
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, want)
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Fatalf("expected a single document, got: %v", err)
+	}
+}
+
+func TestDecoderKeyOrder(t *testing.T) {
+	input := `z = 1
+inline = {y = 1, b = 2}
+[t]
+k = 2
+b.c = 1
+[[arr]]
+x = 1
+y = 2
+[[arr]]
+y = 3
+x = 4
+[[arr.sub]]
+q = 5
+p = 6
+`
+	want := `{"z":1,"inline":{"y":1,"b":2},"t":{"k":2,"b":{"c":1}},"arr":[{"x":1,"y":2},{"y":3,"x":4,"sub":[{"q":5,"p":6}]}]}`
+	got, err := NewDecoder(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if s := gqjson.NewJSON(got).Compact(); s != want {
+		t.Fatalf("failed comparison\ngot: %s\nexpected: %s\n", s, want)
+	}
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	_, err := NewDecoder(strings.NewReader("a = \n")).Next()
+	if err == nil || !strings.Contains(err.Error(), "invalid TOML") {
+		t.Fatalf("expected invalid TOML error, got: %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	v := gqjson.ObjectOf(
+		"name", "gq",
+		"ratio", 2.0,
+		"odd key", "tab\tquote\"",
+		"mixed", []any{int64(1), gqjson.ObjectOf("a", true), []any{}},
+		"deps", gqjson.ObjectOf("cobra", "1.10", "yaml", gqjson.ObjectOf("version", "3")),
+		"bin", []any{gqjson.ObjectOf("name", "gq")},
+	)
+	want := `name = "gq"
+ratio = 2.0
+"odd key" = "tab\tquote\""
+mixed = [1, { a = true }, []]
+
+[deps]
+cobra = "1.10"
+
+[deps.yaml]
+version = "3"
+
+[[bin]]
+name = "gq"
+`
+	got, err := Format(v)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if got != want {
+		t.Fatalf("failed comparison\ngot:\n%s\nexpected:\n%s\n", got, want)
+	}
+	back, err := NewDecoder(strings.NewReader(got)).Next()
+	if err != nil {
+		t.Fatalf("expected the output to read back, instead got: %v", err)
+	}
+	if want := gqjson.NewJSON(v).Compact(); gqjson.NewJSON(back).Compact() != want {
+		t.Fatalf("failed round trip\ngot: %s\nexpected: %s\n", gqjson.NewJSON(back).Compact(), want)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		v    any
+		err  string
+	}{
+		{desc: "array", v: []any{int64(1)}, err: "cannot write an array as TOML"},
+		{desc: "null", v: nil, err: "cannot write null as TOML"},
+		{desc: "nested null", v: gqjson.ObjectOf("a", []any{nil}), err: "cannot write null at .a[0] as TOML"},
+		{desc: "null under odd key", v: gqjson.ObjectOf("a b", nil), err: `cannot write null at .["a b"] as TOML`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := Format(tC.v)
+			if err == nil || !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Package gqxml reads XML documents as the values gq works on.
+//
+// A document is an object with the name of its root element as only key.
+// An element with neither attributes nor child elements is its text, or null
+// when it has none. Any other element is an object: attributes are keys
+// named "@" and the attribute name, child elements are keys named after
+// them, holding an array when the name is repeated, and the text, if it is
+// not only whitespace, is under "#text". Keys come in that order, each in the
+// order of the document. All values are strings, and comments, processing
+// instructions and the order of mixed content are dropped.
+//
+// Names keep their namespace prefix as written, e.g. "soap:Envelope", and
+// xmlns declarations are attributes like any other. With StripNamespaces,
+// names only keep their local part and declarations are dropped.
+package gqxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+// Options are the settings of a Decoder.
+type Options struct {
+	StripNamespaces bool
+}
+
+// Decoder reads the documents of an XML file one at a time. Files usually
+// hold a single document, but several can follow each other.
+type Decoder struct {
+	d    *xml.Decoder
+	opts Options
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader, opts Options) *Decoder {
+	return &Decoder{d: xml.NewDecoder(r), opts: opts}
+}
+
+// element is an element being read.
+type element struct {
+	name     string
+	raw      xml.Name
+	attrs    *gqjson.Object
+	children *gqjson.Object
+	text     strings.Builder
+}
+
+// Next returns the next document, or io.EOF after the last one.
+func (d *Decoder) Next() (any, error) {
+	// RawToken keeps the prefixes, but leaves matching tags to us
+	var stack []*element
+	for {
+		tok, err := d.d.RawToken()
+		if err == io.EOF && len(stack) == 0 {
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("invalid XML: element <%s> is not closed", rawName(stack[len(stack)-1].raw))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			e := &element{name: d.name(tok.Name), raw: tok.Name}
+			for _, a := range tok.Attr {
+				if d.opts.StripNamespaces && (a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns") {
+					continue
+				}
+				if e.attrs == nil {
+					e.attrs = gqjson.NewObject(len(tok.Attr))
+				}
+				e.attrs.Set("@"+d.name(a.Name), a.Value)
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("invalid XML: line %d: unexpected </%s>", d.line(), rawName(tok.Name))
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if tok.Name != e.raw {
+				return nil, fmt.Errorf("invalid XML: line %d: element <%s> closed by </%s>", d.line(), rawName(e.raw), rawName(tok.Name))
+			}
+			if len(stack) == 0 {
+				return gqjson.ObjectOf(e.name, e.value()), nil
+			}
+			stack[len(stack)-1].add(e.name, e.value())
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			} else if strings.TrimSpace(string(tok)) != "" {
+				return nil, fmt.Errorf("invalid XML: line %d: text outside of the root element", d.line())
+			}
+		}
+	}
+}
+
+// name returns the key of an element or attribute name.
+func (d *Decoder) name(n xml.Name) string {
+	if d.opts.StripNamespaces {
+		return n.Local
+	}
+	return rawName(n)
+}
+
+func (d *Decoder) line() int {
+	line, _ := d.d.InputPos()
+	return line
+}
+
+// rawName returns a name as written, with its prefix.
+func rawName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// add adds a child element, turning repeated names into arrays. Elements
+// are never arrays themselves, so an array always holds repeated ones.
+func (e *element) add(name string, v any) {
+	if e.children == nil {
+		e.children = gqjson.NewObject(1)
+	}
+	prev, ok := e.children.Get(name)
+	switch l, isList := prev.([]any); {
+	case !ok:
+		e.children.Set(name, v)
+	case isList:
+		e.children.Set(name, append(l, v))
+	default:
+		e.children.Set(name, []any{prev, v})
+	}
+}
+
+func (e *element) value() any {
+	text := strings.TrimSpace(e.text.String())
+	if e.attrs == nil && e.children == nil {
+		if text == "" {
+			return nil
+		}
+		return text
+	}
+	out := gqjson.NewObject(0)
+	if e.attrs != nil {
+		out = e.attrs
+	}
+	if e.children != nil {
+		for k, v := range e.children.All() {
+			out.Set(k, v)
+		}
+	}
+	if text != "" {
+		out.Set("#text", text)
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package gqxml
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+func TestDecoder(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<!-- orders -->
+<s:orders xmlns:s="urn:shop" s:version="2">
+  <order id="1">
+    <item>apple &amp; pear</item>
+    <item/>
+    <item>kiwi</item>
+  </order>
+  <note>mixed <b>bold</b> text</note>
+  <code><![CDATA[<x/>]]></code>
+</s:orders>
+<next/>
+`
+	testCases := []struct {
+		desc string
+		opts Options
+		want []any
+	}{
+		{
+			desc: "prefixes",
+			want: []any{
+				gqjson.ObjectOf(
+					"s:orders", gqjson.ObjectOf(
+						"@xmlns:s", "urn:shop",
+						"@s:version", "2",
+						"order", gqjson.ObjectOf(
+							"@id", "1",
+							"item", []any{"apple & pear", nil, "kiwi"},
+						),
+						"note", gqjson.ObjectOf("b", "bold", "#text", "mixed  text"),
+						"code", "<x/>",
+					),
+				),
+				gqjson.ObjectOf("next", nil),
+			},
+		},
+		{
+			desc: "stripped namespaces",
+			opts: Options{StripNamespaces: true},
+			want: []any{
+				gqjson.ObjectOf(
+					"orders", gqjson.ObjectOf(
+						"@version", "2",
+						"order", gqjson.ObjectOf(
+							"@id", "1",
+							"item", []any{"apple & pear", nil, "kiwi"},
+						),
+						"note", gqjson.ObjectOf("b", "bold", "#text", "mixed  text"),
+						"code", "<x/>",
+					),
+				),
+				gqjson.ObjectOf("next", nil),
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(input), tC.opts)
+			var got []any
+			for {
+				v, err := d.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected no error, instead got: %v", err)
+				}
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+		err   string
+	}{
+		{desc: "mismatched tags", input: "<a><b></a>", err: "element <b> closed by </a>"},
+		{desc: "unclosed", input: "<a><b/>", err: "element <a> is not closed"},
+		{desc: "stray end", input: "</a>", err: "unexpected </a>"},
+		{desc: "text outside", input: "<a/>text", err: "text outside of the root element"},
+		{desc: "syntax", input: "<a b=1/>", err: "invalid XML"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(tC.input), Options{})
+			var err error
+			for err == nil {
+				_, err = d.Next()
+			}
+			if !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Package gqyaml converts between YAML documents and the values gq works
+// on, which are the same as those of gqjson.
+package gqyaml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+	"go.yaml.in/yaml/v3"
+)
+
+// Decoder reads the documents of a YAML stream one at a time.
+type Decoder struct {
+	d *yaml.Decoder
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{d: yaml.NewDecoder(r)}
+}
+
+// Next returns the value of the next document, or io.EOF after the last one.
+func (d *Decoder) Next() (any, error) {
+	var n yaml.Node
+	if err := d.d.Decode(&n); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+	return (&converter{aliases: map[*yaml.Node]bool{}}).value(&n)
+}
+
+// converter converts nodes to values. aliases holds the anchors being
+// expanded, to detect aliases that refer to themselves.
+type converter struct {
+	aliases map[*yaml.Node]bool
+}
+
+// value converts a node, resolving aliases and merge keys.
+func (c *converter) value(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return c.value(n.Content[0])
+	case yaml.AliasNode:
+		if c.aliases[n.Alias] {
+			return nil, fmt.Errorf("invalid YAML: line %d: alias *%s refers to itself", n.Line, n.Value)
+		}
+		c.aliases[n.Alias] = true
+		defer delete(c.aliases, n.Alias)
+		return c.value(n.Alias)
+	case yaml.SequenceNode:
+		out := make([]any, 0, len(n.Content))
+		for _, e := range n.Content {
+			v, err := c.value(e)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case yaml.MappingNode:
+		return c.mapping(n)
+	}
+	return scalar(n)
+}
+
+// mapping converts a mapping. Keys given explicitly win over merged ones,
+// and of several merged mappings the first one wins. Keys keep the order
+// they are first seen in, merged ones coming in place of the << key.
+func (c *converter) mapping(n *yaml.Node) (*gqjson.Object, error) {
+	out := gqjson.NewObject(len(n.Content) / 2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+			ms, err := c.merges(v)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range ms {
+				for k, v := range m.All() {
+					if _, ok := out.Get(k); !ok {
+						out.Set(k, v)
+					}
+				}
+			}
+			continue
+		}
+		key, err := mappingKey(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := c.value(v)
+		if err != nil {
+			return nil, err
+		}
+		out.Set(key, val)
+	}
+	return out, nil
+}
+
+// merges returns the mappings merged in with <<, which is either a single
+// mapping or a sequence of them.
+func (c *converter) merges(n *yaml.Node) ([]*gqjson.Object, error) {
+	nodes := []*yaml.Node{n}
+	if n.Kind == yaml.SequenceNode {
+		nodes = n.Content
+	} else if n.Kind == yaml.AliasNode && n.Alias.Kind == yaml.SequenceNode {
+		nodes = n.Alias.Content
+	}
+	var out []*gqjson.Object
+	for _, e := range nodes {
+		v, err := c.value(e)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := v.(*gqjson.Object)
+		if !ok {
+			return nil, fmt.Errorf("invalid YAML: line %d: merge value must be a mapping", e.Line)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// mappingKey converts a key to a string, since objects only have string
+// keys. Keys that are not strings are written as JSON.
+func mappingKey(n *yaml.Node) (string, error) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("invalid YAML: line %d: mapping keys must be scalars", n.Line)
+	}
+	v, err := scalar(n)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return gqjson.NewJSON(v).Compact(), nil
+}
+
+// scalar converts a scalar according to its resolved tag. Timestamps,
+// binary data and unknown tags are kept as strings.
+func scalar(n *yaml.Node) (any, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %v", err)
+		}
+		return b, nil
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err == nil {
+			return i, nil
+		}
+		// too large for an int64
+		f, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: line %d: invalid integer %s", n.Line, n.Value)
+		}
+		return f, nil
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %v", err)
+		}
+		return f, nil
+	}
+	return n.Value, nil
+}
+
+// Format prints v as a YAML document, with object keys in their order.
+func Format(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node(v)); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// node builds the YAML node of v. Numbers are written as gq prints them in
+// JSON.
+func node(v any) *yaml.Node {
+	switch v := v.(type) {
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	case int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v, 10)}
+	case float64:
+		if math.IsNaN(v) {
+			return node(nil)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: gqjson.NewJSON(v).Compact()}
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	case []any:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, e := range v {
+			n.Content = append(n.Content, node(e))
+		}
+		if len(v) == 0 {
+			n.Style = yaml.FlowStyle
+		}
+		return n
+	case *gqjson.Object:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for k, e := range v.All() {
+			n.Content = append(n.Content, node(k), node(e))
+		}
+		if v.Len() == 0 {
+			n.Style = yaml.FlowStyle
+		}
+		return n
+	}
+	panic(fmt.Sprintf("gqyaml: unsupported value %T", v))
+}
@@ -0,0 +1,115 @@
+package gqyaml
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmpargana/gq/internal/gqjson"
+)
+
+func TestDecoder(t *testing.T) {
+	testCases := []struct {
+		desc, input string
+		values      []any
+	}{
+		{
+			desc:   "scalars",
+			input:  "a: 1\nb: 1.5\nc: true\nd: ~\ne: text\nf: '1'\ng: 2001-12-14\nh: 123456789012345678901\n",
+			values: []any{gqjson.ObjectOf("a", int64(1), "b", 1.5, "c", true, "d", nil, "e", "text", "f", "1", "g", "2001-12-14", "h", 123456789012345678901.0)},
+		},
+		{
+			desc:   "documents",
+			input:  "---\n[1, 2]\n---\n- x\n---\n",
+			values: []any{[]any{int64(1), int64(2)}, []any{"x"}, nil},
+		},
+		{
+			desc:  "anchors and aliases",
+			input: "a: &x {b: [1]}\nc: *x\n",
+			values: []any{gqjson.ObjectOf(
+				"a", gqjson.ObjectOf("b", []any{int64(1)}),
+				"c", gqjson.ObjectOf("b", []any{int64(1)}),
+			)},
+		},
+		{
+			desc:  "merge keys",
+			input: "one: &one {x: 1, y: 1}\ntwo: &two {y: 2, z: 2}\nc:\n  <<: [*one, *two]\n  x: 3\n",
+			values: []any{gqjson.ObjectOf(
+				"one", gqjson.ObjectOf("x", int64(1), "y", int64(1)),
+				"two", gqjson.ObjectOf("y", int64(2), "z", int64(2)),
+				"c", gqjson.ObjectOf("x", int64(3), "y", int64(1), "z", int64(2)),
+			)},
+		},
+		{
+			desc:   "keys keep their order",
+			input:  "z: 1\na: {y: 2, b: 3}\nm: 4\n",
+			values: []any{gqjson.ObjectOf("z", int64(1), "a", gqjson.ObjectOf("y", int64(2), "b", int64(3)), "m", int64(4))},
+		},
+		{
+			desc:  "merged keys come in place of <<",
+			input: "base: &b {y: 1, x: 1}\nc: {z: 2, <<: *b, x: 3}\n",
+			values: []any{gqjson.ObjectOf(
+				"base", gqjson.ObjectOf("y", int64(1), "x", int64(1)),
+				"c", gqjson.ObjectOf("z", int64(2), "y", int64(1), "x", int64(3)),
+			)},
+		},
+		{
+			desc:   "keys that are not strings",
+			input:  "1: a\ntrue: b\n",
+			values: []any{gqjson.ObjectOf("1", "a", "true", "b")},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(tC.input))
+			var got []any
+			for {
+				v, err := d.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected no error, instead got: %v", err)
+				}
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tC.values) {
+				t.Fatalf("failed comparison\ngot: %v\nexpected: %v\n", got, tC.values)
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	testCases := []struct {
+		desc, input, err string
+	}{
+		{desc: "syntax", input: "a: [1, 2\n", err: "invalid YAML"},
+		{desc: "recursive alias", input: "a: &x [1, *x]\n", err: "refers to itself"},
+		{desc: "merge of a scalar", input: "a:\n  <<: 1\n", err: "must be a mapping"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := NewDecoder(strings.NewReader(tC.input)).Next()
+			if err == nil || !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %v\n", tC.err, err)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	v := gqjson.ObjectOf(
+		"b", []any{int64(1), 2.5, "true", nil},
+		"a", gqjson.ObjectOf("x", "multi\nline", "e", []any{}),
+	)
+	want := "b:\n  - 1\n  - 2.5\n  - \"true\"\n  - null\na:\n  x: |-\n    multi\n    line\n  e: []\n"
+	got, err := Format(v)
+	if err != nil {
+		t.Fatalf("expected no error, instead got: %v", err)
+	}
+	if got != want {
+		t.Fatalf("failed comparison\ngot:\n%s\nexpected:\n%s\n", got, want)
+	}
+}
@@ -2,8 +2,10 @@ package lexer
 
 import (
 	"bufio"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf16"
 )
 
 type TokenKind int
@@ -22,17 +24,134 @@ const (
 	STRING
 	EOF
 	ILLEGAL
+	LPAREN
+	RPAREN
+	SEMICOLON
+	PLUS
+	MINUS
+	MULT
+	DIV
+	MOD
+	DEFINEDOR
+	EQ
+	NEQ
+	LESS
+	LESSEQ
+	GREATER
+	GREATEREQ
+	SET
+	SETPIPE
+	SETPLUS
+	SETMINUS
+	SETMULT
+	SETDIV
+	SETMOD
+	SETDEFINEDOR
+	REC
+	KEYWORD
+	QUESTION
+	VARIABLE
+	LOC
+	FORMAT
+	QQSTRINGSTART
+	QQSTRINGEND
+	INTERPSTART
+	INTERPEND
 )
 
+// keywords are only reserved when they are not written directly after a dot,
+// so that `.end` is still a field while `. end` closes a block.
+var keywords = map[string]bool{
+	"and":     true,
+	"or":      true,
+	"if":      true,
+	"then":    true,
+	"elif":    true,
+	"else":    true,
+	"end":     true,
+	"as":      true,
+	"reduce":  true,
+	"foreach": true,
+	"try":     true,
+	"catch":   true,
+	"label":   true,
+	"def":     true,
+}
+
 type Token struct {
 	Kind  TokenKind
 	Value string
 }
 
+func (t Token) String() string {
+	switch t.Kind {
+	case IDENT, NUMBER, KEYWORD, ILLEGAL:
+		return t.Value
+	case VARIABLE:
+		return "$" + t.Value
+	case LOC:
+		return "$__loc__"
+	case FORMAT:
+		return "@" + t.Value
+	case QQSTRINGSTART, QQSTRINGEND:
+		return `"`
+	case INTERPSTART:
+		return `\(`
+	case INTERPEND:
+		return ")"
+	case STRING:
+		return `"` + t.Value + `"`
+	case EOF:
+		return "end of program"
+	}
+	return symbols[t.Kind]
+}
+
+var symbols = map[TokenKind]string{
+	LBRACKET:     "{",
+	RBRACKET:     "}",
+	LBRACE:       "[",
+	RBRACE:       "]",
+	DOT:          ".",
+	PIPE:         "|",
+	COMMA:        ",",
+	COLON:        ":",
+	LPAREN:       "(",
+	RPAREN:       ")",
+	SEMICOLON:    ";",
+	PLUS:         "+",
+	MINUS:        "-",
+	MULT:         "*",
+	DIV:          "/",
+	MOD:          "%",
+	DEFINEDOR:    "//",
+	EQ:           "==",
+	NEQ:          "!=",
+	LESS:         "<",
+	LESSEQ:       "<=",
+	GREATER:      ">",
+	GREATEREQ:    ">=",
+	SET:          "=",
+	SETPIPE:      "|=",
+	SETPLUS:      "+=",
+	SETMINUS:     "-=",
+	SETMULT:      "*=",
+	SETDIV:       "/=",
+	SETMOD:       "%=",
+	SETDEFINEDOR: "//=",
+	REC:          "..",
+	QUESTION:     "?",
+}
+
 type Lexer struct {
 	r   *bufio.Reader
 	ch  rune
 	eof bool
+	// afterDot is set while the previous token was a dot with nothing in between
+	afterDot bool
+	line     int
+	// pending holds the remaining tokens of an interpolated string
+	pending []Token
 }
 
 func Lex(s string) []Token {
@@ -57,20 +176,35 @@ func newLexer(s string) *Lexer {
 	ch, _, err := r.ReadRune()
 	if err != nil {
 		return &Lexer{
-			r:   r,
-			ch:  0,
-			eof: true,
+			r:    r,
+			ch:   0,
+			eof:  true,
+			line: 1,
 		}
 	}
 	return &Lexer{
-		r:   r,
-		ch:  ch,
-		eof: false,
+		r:    r,
+		ch:   ch,
+		eof:  false,
+		line: 1,
 	}
 }
 
 func (l *Lexer) nextToken() Token {
-	l.skipWhitespace()
+	var tok Token
+	if len(l.pending) > 0 {
+		tok, l.pending = l.pending[0], l.pending[1:]
+	} else {
+		tok = l.scan()
+	}
+	l.afterDot = tok.Kind == DOT
+	return tok
+}
+
+func (l *Lexer) scan() Token {
+	if l.skipWhitespace() {
+		l.afterDot = false
+	}
 
 	switch l.ch {
 	case 0:
@@ -78,6 +212,10 @@ func (l *Lexer) nextToken() Token {
 		return Token{Kind: EOF}
 	case '.':
 		l.read()
+		if l.ch == '.' {
+			l.read()
+			return Token{Kind: REC}
+		}
 		return Token{Kind: DOT}
 	case ',':
 		l.read()
@@ -85,9 +223,59 @@ func (l *Lexer) nextToken() Token {
 	case ':':
 		l.read()
 		return Token{Kind: COLON}
+	case ';':
+		l.read()
+		return Token{Kind: SEMICOLON}
+	case '(':
+		l.read()
+		return Token{Kind: LPAREN}
+	case ')':
+		l.read()
+		return Token{Kind: RPAREN}
+	case '?':
+		l.read()
+		return Token{Kind: QUESTION}
+	case '$':
+		return l.readVariable()
+	case '@':
+		l.read()
+		if !isIdentStart(l.ch) {
+			return Token{Kind: ILLEGAL, Value: "@"}
+		}
+		return Token{Kind: FORMAT, Value: l.readIdent().Value}
 	case '|':
+		return l.readOperator(PIPE, SETPIPE)
+	case '+':
+		return l.readOperator(PLUS, SETPLUS)
+	case '-':
+		return l.readOperator(MINUS, SETMINUS)
+	case '*':
+		return l.readOperator(MULT, SETMULT)
+	case '%':
+		return l.readOperator(MOD, SETMOD)
+	case '=':
+		return l.readOperator(SET, EQ)
+	case '<':
+		return l.readOperator(LESS, LESSEQ)
+	case '>':
+		return l.readOperator(GREATER, GREATEREQ)
+	case '!':
+		l.read()
+		if l.ch != '=' {
+			return Token{Kind: ILLEGAL, Value: "!"}
+		}
 		l.read()
-		return Token{Kind: PIPE}
+		return Token{Kind: NEQ}
+	case '/':
+		l.read()
+		if l.ch != '/' {
+			if l.ch == '=' {
+				l.read()
+				return Token{Kind: SETDIV}
+			}
+			return Token{Kind: DIV}
+		}
+		return l.readOperator(DEFINEDOR, SETDEFINEDOR)
 	case '{':
 		l.read()
 		return Token{Kind: LBRACKET}
@@ -108,7 +296,9 @@ func (l *Lexer) nextToken() Token {
 			return l.readIdent()
 		}
 		if l.ch == '"' {
-			return l.readString()
+			toks := l.readString()
+			l.pending = append(l.pending, toks[1:]...)
+			return toks[0]
 		}
 		illegal := l.ch
 		l.read()
@@ -116,24 +306,193 @@ func (l *Lexer) nextToken() Token {
 	}
 }
 
+// readOperator reads a single character operator, or its variant when the
+// operator is directly followed by '='.
+func (l *Lexer) readOperator(single, withEq TokenKind) Token {
+	l.read()
+	if l.ch == '=' {
+		l.read()
+		return Token{Kind: withEq}
+	}
+	return Token{Kind: single}
+}
+
 func (l *Lexer) readNumber() Token {
 	var b strings.Builder
-	for isDigit(l.ch) {
+	l.readDigits(&b)
+	if l.ch == '.' && isDigit(l.peek()) {
 		b.WriteRune(l.ch)
 		l.read()
+		l.readDigits(&b)
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peek()
+		if isDigit(next) || next == '+' || next == '-' {
+			b.WriteRune(l.ch)
+			l.read()
+			b.WriteRune(l.ch)
+			l.read()
+			l.readDigits(&b)
+		}
 	}
 	return Token{Kind: NUMBER, Value: b.String()}
 }
 
-func (l *Lexer) readString() Token {
+func (l *Lexer) readDigits(b *strings.Builder) {
+	for isDigit(l.ch) {
+		b.WriteRune(l.ch)
+		l.read()
+	}
+}
+
+// readString reads a string literal, resolving escape sequences. A plain
+// string is a single STRING token; a string with `\(expr)` interpolations is
+// returned as QQSTRINGSTART, its literal parts as STRING tokens, the tokens
+// of every expression between INTERPSTART and INTERPEND, and QQSTRINGEND.
+func (l *Lexer) readString() []Token {
 	l.read() // skip "
+	var toks []Token
 	var b strings.Builder
+	for l.ch != '"' {
+		if l.ch == 0 {
+			return []Token{{Kind: ILLEGAL, Value: "unterminated string"}}
+		}
+		if l.ch != '\\' {
+			b.WriteRune(l.ch)
+			l.read()
+			continue
+		}
+		l.read() // skip \
+		if l.ch == '(' {
+			l.read()
+			toks = append(toks, Token{Kind: STRING, Value: b.String()}, Token{Kind: INTERPSTART})
+			b.Reset()
+			inner, ok := l.readInterpolation()
+			if !ok {
+				return []Token{{Kind: ILLEGAL, Value: "unterminated string interpolation"}}
+			}
+			toks = append(toks, inner...)
+			toks = append(toks, Token{Kind: INTERPEND})
+			continue
+		}
+		if !l.readEscape(&b) {
+			tok := Token{Kind: ILLEGAL, Value: "invalid escape \\" + string(l.ch)}
+			l.skipString()
+			return []Token{tok}
+		}
+	}
+	l.read() // skip "
+
+	if toks == nil {
+		return []Token{{Kind: STRING, Value: b.String()}}
+	}
+	toks = append([]Token{{Kind: QQSTRINGSTART}}, toks...)
+	toks = append(toks, Token{Kind: STRING, Value: b.String()}, Token{Kind: QQSTRINGEND})
+	return toks
+}
+
+// skipString consumes the rest of a string after an error, so that lexing
+// resumes after its closing quote.
+func (l *Lexer) skipString() {
 	for l.ch != '"' && l.ch != 0 {
+		if l.ch == '\\' {
+			l.read()
+		}
+		l.read()
+	}
+	l.read()
+}
+
+// readInterpolation lexes the expression of `\(expr)` up to the matching
+// parenthesis, which is consumed but not returned.
+func (l *Lexer) readInterpolation() ([]Token, bool) {
+	var toks []Token
+	depth := 0
+	for {
+		tok := l.nextToken()
+		switch tok.Kind {
+		case EOF, ILLEGAL:
+			return nil, false
+		case LPAREN:
+			depth++
+		case RPAREN:
+			if depth == 0 {
+				return toks, true
+			}
+			depth--
+		}
+		toks = append(toks, tok)
+	}
+}
+
+var escapes = map[rune]rune{
+	'"':  '"',
+	'\\': '\\',
+	'/':  '/',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+}
+
+// readEscape reads the escape sequence following a backslash.
+func (l *Lexer) readEscape(b *strings.Builder) bool {
+	if r, ok := escapes[l.ch]; ok {
+		b.WriteRune(r)
+		l.read()
+		return true
+	}
+	if l.ch != 'u' {
+		return false
+	}
+	l.read()
+	r, ok := l.readHex()
+	if !ok {
+		return false
+	}
+	if utf16.IsSurrogate(r) && l.ch == '\\' && l.peek() == 'u' {
+		l.read()
+		l.read()
+		low, ok := l.readHex()
+		if !ok {
+			return false
+		}
+		r = utf16.DecodeRune(r, low)
+	}
+	b.WriteRune(r)
+	return true
+}
+
+func (l *Lexer) readHex() (rune, bool) {
+	var r rune
+	for range 4 {
+		d, err := strconv.ParseUint(string(l.ch), 16, 8)
+		if err != nil {
+			return 0, false
+		}
+		r = r<<4 | rune(d)
+		l.read()
+	}
+	return r, true
+}
+
+// readVariable reads `$name`. `$__loc__` gets its own token carrying the
+// line it was found on.
+func (l *Lexer) readVariable() Token {
+	l.read() // skip $
+	if !isIdentStart(l.ch) {
+		return Token{Kind: ILLEGAL, Value: "$"}
+	}
+	var b strings.Builder
+	for isIdentChar(l.ch) {
 		b.WriteRune(l.ch)
 		l.read()
 	}
-	l.read() // skip "
-	return Token{Kind: STRING, Value: b.String()}
+	if b.String() == "__loc__" {
+		return Token{Kind: LOC, Value: strconv.Itoa(l.line)}
+	}
+	return Token{Kind: VARIABLE, Value: b.String()}
 }
 
 func (l *Lexer) readIdent() Token {
@@ -142,10 +501,17 @@ func (l *Lexer) readIdent() Token {
 		b.WriteRune(l.ch)
 		l.read()
 	}
-	return Token{Kind: IDENT, Value: b.String()}
+	ident := b.String()
+	if keywords[ident] && !l.afterDot {
+		return Token{Kind: KEYWORD, Value: ident}
+	}
+	return Token{Kind: IDENT, Value: ident}
 }
 
 func (l *Lexer) read() {
+	if l.ch == '\n' {
+		l.line++
+	}
 	ch, _, err := l.r.ReadRune()
 	if err != nil {
 		l.ch = 0
@@ -154,10 +520,35 @@ func (l *Lexer) read() {
 	l.ch = ch
 }
 
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\n' || l.ch == '\t' {
+// peek returns the character after the current one without consuming it.
+// Only ASCII lookahead is needed by the lexer.
+func (l *Lexer) peek() rune {
+	b, err := l.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return rune(b[0])
+}
+
+// skipWhitespace skips whitespace and `#` comments, which run to the end of
+// the line.
+func (l *Lexer) skipWhitespace() bool {
+	skipped := false
+	for isWhitespace(l.ch) || l.ch == '#' {
+		skipped = true
+		if l.ch == '#' {
+			for l.ch != '\n' && l.ch != 0 {
+				l.read()
+			}
+			continue
+		}
 		l.read()
 	}
+	return skipped
+}
+
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
 }
 
 // TODO: move to utils
@@ -68,6 +68,139 @@ func TestSimpleLexer(t *testing.T) {
 				{Kind: EOF},
 			},
 		},
+		{
+			desc:  "update operators",
+			input: `.a |= . + 1.5 | .b //= -2 | .c = .d // 1e3`,
+			tokens: []Token{
+				{Kind: DOT},
+				{Kind: IDENT, Value: "a"},
+				{Kind: SETPIPE},
+				{Kind: DOT},
+				{Kind: PLUS},
+				{Kind: NUMBER, Value: "1.5"},
+				{Kind: PIPE},
+				{Kind: DOT},
+				{Kind: IDENT, Value: "b"},
+				{Kind: SETDEFINEDOR},
+				{Kind: MINUS},
+				{Kind: NUMBER, Value: "2"},
+				{Kind: PIPE},
+				{Kind: DOT},
+				{Kind: IDENT, Value: "c"},
+				{Kind: SET},
+				{Kind: DOT},
+				{Kind: IDENT, Value: "d"},
+				{Kind: DEFINEDOR},
+				{Kind: NUMBER, Value: "1e3"},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "arithmetic and comparison operators",
+			input: `+= -= *= /= %= * / % == != < <= > >= ( ; ) ..`,
+			tokens: []Token{
+				{Kind: SETPLUS},
+				{Kind: SETMINUS},
+				{Kind: SETMULT},
+				{Kind: SETDIV},
+				{Kind: SETMOD},
+				{Kind: MULT},
+				{Kind: DIV},
+				{Kind: MOD},
+				{Kind: EQ},
+				{Kind: NEQ},
+				{Kind: LESS},
+				{Kind: LESSEQ},
+				{Kind: GREATER},
+				{Kind: GREATEREQ},
+				{Kind: LPAREN},
+				{Kind: SEMICOLON},
+				{Kind: RPAREN},
+				{Kind: REC},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "keywords are fields after a dot",
+			input: `.and and . or .end`,
+			tokens: []Token{
+				{Kind: DOT},
+				{Kind: IDENT, Value: "and"},
+				{Kind: KEYWORD, Value: "and"},
+				{Kind: DOT},
+				{Kind: KEYWORD, Value: "or"},
+				{Kind: DOT},
+				{Kind: IDENT, Value: "end"},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "try catch and location",
+			input: "try .a? catch\n$__loc__ | $x",
+			tokens: []Token{
+				{Kind: KEYWORD, Value: "try"},
+				{Kind: DOT},
+				{Kind: IDENT, Value: "a"},
+				{Kind: QUESTION},
+				{Kind: KEYWORD, Value: "catch"},
+				{Kind: LOC, Value: "2"},
+				{Kind: PIPE},
+				{Kind: VARIABLE, Value: "x"},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "comments",
+			input: "# keep only names\n.a # field\n| \"#\" # not a comment in strings\n$__loc__ #",
+			tokens: []Token{
+				{Kind: DOT},
+				{Kind: IDENT, Value: "a"},
+				{Kind: PIPE},
+				{Kind: STRING, Value: "#"},
+				{Kind: LOC, Value: "4"},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "string escapes",
+			input: `"a\"b\\\né😀"`,
+			tokens: []Token{
+				{Kind: STRING, Value: "a\"b\\\né😀"},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "string interpolation",
+			input: `@csv "x\(.a | "\(1)")y"`,
+			tokens: []Token{
+				{Kind: FORMAT, Value: "csv"},
+				{Kind: QQSTRINGSTART},
+				{Kind: STRING, Value: "x"},
+				{Kind: INTERPSTART},
+				{Kind: DOT},
+				{Kind: IDENT, Value: "a"},
+				{Kind: PIPE},
+				{Kind: QQSTRINGSTART},
+				{Kind: STRING, Value: ""},
+				{Kind: INTERPSTART},
+				{Kind: NUMBER, Value: "1"},
+				{Kind: INTERPEND},
+				{Kind: STRING, Value: ""},
+				{Kind: QQSTRINGEND},
+				{Kind: INTERPEND},
+				{Kind: STRING, Value: "y"},
+				{Kind: QQSTRINGEND},
+				{Kind: EOF},
+			},
+		},
+		{
+			desc:  "invalid escape",
+			input: `"\q"`,
+			tokens: []Token{
+				{Kind: ILLEGAL, Value: `invalid escape \q`},
+				{Kind: EOF},
+			},
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -1,28 +1,56 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/jmpargana/gq/internal/gqjson"
 	"github.com/jmpargana/gq/internal/lexer"
 	u "github.com/jmpargana/gq/internal/utils"
 )
 
+// programFile is reported by $__loc__ for programs given on the command line.
+const programFile = "<top-level>"
+
 type Parser struct {
 	ts  []lexer.Token
 	pos int
+	err error
 }
 
 func NewParser(cs []lexer.Token) *Parser {
 	return &Parser{ts: cs, pos: 0}
 }
 
+// Parse parses the whole program and reports the first syntax error found.
+func (p *Parser) Parse() (u.Node, error) {
+	n := p.ParseExpr()
+	if p.peek().Kind != lexer.EOF {
+		p.fail("unexpected token %s", p.peek())
+	}
+	return n, p.err
+}
+
+func (p *Parser) fail(format string, args ...any) {
+	if p.err == nil {
+		p.err = fmt.Errorf("syntax error: "+format, args...)
+	}
+}
+
 func (p *Parser) peek() lexer.Token {
+	if p.pos >= len(p.ts) {
+		return lexer.Token{Kind: lexer.EOF}
+	}
 	return p.ts[p.pos]
 }
 
 func (p *Parser) advance() lexer.Token {
-	t := p.ts[p.pos]
-	p.pos++
+	t := p.peek()
+	if p.pos < len(p.ts) {
+		p.pos++
+	}
 	return t
 }
 
@@ -37,97 +65,458 @@ func (p *Parser) match(kind lexer.TokenKind) bool {
 	return false
 }
 
+func (p *Parser) matchKeyword(kw string) bool {
+	if t := p.peek(); t.Kind == lexer.KEYWORD && t.Value == kw {
+		p.advance()
+		return true
+	}
+	return false
+}
+
 func (p *Parser) expect(k lexer.TokenKind) lexer.Token {
 	if p.peek().Kind == k {
 		return p.advance()
 	}
+	p.fail("unexpected token %s, expected %s", p.peek(), lexer.Token{Kind: k})
 	return lexer.Token{}
 }
 
 func (p *Parser) ParseExpr() u.Node {
-	term := p.parseTerm()
+	return p.parsePipe(true)
+}
+
+// parsePipe parses a chain of pipes. Object values are parsed without the
+// comma operator, which would otherwise swallow the next key.
+func (p *Parser) parsePipe(comma bool) u.Node {
+	term := p.parseComma(comma)
 
 	for p.match(lexer.PIPE) {
-		right := p.parseTerm()
+		right := p.parseComma(comma)
 		term = u.Node{Value: u.Cmd{Kind: u.PIPE}, Children: []u.Node{term, right}}
 	}
 
 	return term
 }
 
+func (p *Parser) parseComma(comma bool) u.Node {
+	left := p.parseAlternative()
+	for comma && p.match(lexer.COMMA) {
+		right := p.parseAlternative()
+		left = u.Node{Value: u.Cmd{Kind: u.COMMA}, Children: []u.Node{left, right}}
+	}
+	return left
+}
+
+func (p *Parser) parseAlternative() u.Node {
+	left := p.parseUpdate()
+	if p.match(lexer.DEFINEDOR) {
+		right := p.parseAlternative()
+		return u.Node{Value: u.Cmd{Kind: u.ALT}, Children: []u.Node{left, right}}
+	}
+	return left
+}
+
+var updateOps = map[lexer.TokenKind]string{
+	lexer.SET:          "=",
+	lexer.SETPIPE:      "|=",
+	lexer.SETPLUS:      "+=",
+	lexer.SETMINUS:     "-=",
+	lexer.SETMULT:      "*=",
+	lexer.SETDIV:       "/=",
+	lexer.SETMOD:       "%=",
+	lexer.SETDEFINEDOR: "//=",
+}
+
+func (p *Parser) parseUpdate() u.Node {
+	left := p.parseOr()
+	op, ok := updateOps[p.peek().Kind]
+	if !ok {
+		return left
+	}
+	p.advance()
+	right := p.parseOr()
+	return u.Node{Value: u.Cmd{Kind: u.UPDATE, Ident: op}, Children: []u.Node{left, right}}
+}
+
+func (p *Parser) parseOr() u.Node {
+	left := p.parseAnd()
+	for p.matchKeyword("or") {
+		right := p.parseAnd()
+		left = u.Node{Value: u.Cmd{Kind: u.OR}, Children: []u.Node{left, right}}
+	}
+	return left
+}
+
+func (p *Parser) parseAnd() u.Node {
+	left := p.parseComparison()
+	for p.matchKeyword("and") {
+		right := p.parseComparison()
+		left = u.Node{Value: u.Cmd{Kind: u.AND}, Children: []u.Node{left, right}}
+	}
+	return left
+}
+
+var comparisonOps = map[lexer.TokenKind]string{
+	lexer.EQ:        "==",
+	lexer.NEQ:       "!=",
+	lexer.LESS:      "<",
+	lexer.LESSEQ:    "<=",
+	lexer.GREATER:   ">",
+	lexer.GREATEREQ: ">=",
+}
+
+func (p *Parser) parseComparison() u.Node {
+	left := p.parseAdditive()
+	op, ok := comparisonOps[p.peek().Kind]
+	if !ok {
+		return left
+	}
+	p.advance()
+	right := p.parseAdditive()
+	return binop(op, left, right)
+}
+
+func (p *Parser) parseAdditive() u.Node {
+	left := p.parseMultiplicative()
+	for {
+		switch {
+		case p.match(lexer.PLUS):
+			left = binop("+", left, p.parseMultiplicative())
+		case p.match(lexer.MINUS):
+			left = binop("-", left, p.parseMultiplicative())
+		default:
+			return left
+		}
+	}
+}
+
+func (p *Parser) parseMultiplicative() u.Node {
+	left := p.parseUnary()
+	for {
+		switch {
+		case p.match(lexer.MULT):
+			left = binop("*", left, p.parseUnary())
+		case p.match(lexer.DIV):
+			left = binop("/", left, p.parseUnary())
+		case p.match(lexer.MOD):
+			left = binop("%", left, p.parseUnary())
+		default:
+			return left
+		}
+	}
+}
+
+func (p *Parser) parseUnary() u.Node {
+	if p.match(lexer.MINUS) {
+		operand := p.parseUnary()
+		switch n := operand.Value.Literal.(type) {
+		case int64:
+			return literal(-n)
+		case float64:
+			return literal(-n)
+		}
+		return u.Node{Value: u.Cmd{Kind: u.PIPE}, Children: []u.Node{operand, call("_negate")}}
+	}
+	term := p.parsePostfix()
+	if p.matchKeyword("as") {
+		return p.parseBinding(term)
+	}
+	return term
+}
+
+// parseBinding parses `term as $name | body`. The body extends as far to the
+// right as possible, so `. as $x | $x, 1` binds $x in both outputs.
+func (p *Parser) parseBinding(term u.Node) u.Node {
+	name := p.expect(lexer.VARIABLE).Value
+	p.expect(lexer.PIPE)
+	body := p.ParseExpr()
+	return u.Node{Value: u.Cmd{Kind: u.AS, Ident: name}, Children: []u.Node{term, body}}
+}
+
+// parsePostfix parses a term followed by index suffixes such as `(.a).b` or
+// `[1, 2][0]`, or by `?`. Suffixes of `.` terms are consumed by parseIndex
+// directly, except for indices computed by an expression such as `.[$k]`.
+func (p *Parser) parsePostfix() u.Node {
+	term := p.parseTerm()
+	for {
+		switch p.peek().Kind {
+		case lexer.QUESTION:
+			p.advance()
+			term = u.Node{Value: u.Cmd{Kind: u.TRY}, Children: []u.Node{term}}
+		case lexer.DOT, lexer.LBRACE:
+			idxs := p.parseFields(nil, false)
+			if len(idxs) == 0 && p.peek().Kind == lexer.LBRACE {
+				p.advance()
+				key := p.ParseExpr()
+				p.expect(lexer.RBRACE)
+				term = u.Node{Value: u.Cmd{Kind: u.LOOKUP}, Children: []u.Node{term, key}}
+				continue
+			}
+			if len(idxs) == 0 {
+				return term
+			}
+			idx := u.Node{Value: u.Cmd{Kind: u.IDX, Fields: idxs}}
+			term = u.Node{Value: u.Cmd{Kind: u.PIPE}, Children: []u.Node{term, idx}}
+		default:
+			return term
+		}
+	}
+}
+
 func (p *Parser) parseTerm() u.Node {
 	switch p.peek().Kind {
 	case lexer.DOT:
 		return p.parseIndex()
+	case lexer.REC:
+		p.advance()
+		return call("recurse")
+	case lexer.NUMBER:
+		return p.parseNumber()
+	case lexer.STRING:
+		t := p.advance()
+		return literal(t.Value)
+	case lexer.QQSTRINGSTART:
+		return p.parseInterpolation("text")
+	case lexer.FORMAT:
+		return p.parseFormat()
+	case lexer.LPAREN:
+		p.advance()
+		expr := p.ParseExpr()
+		p.expect(lexer.RPAREN)
+		return expr
 	case lexer.LBRACE:
 		p.advance()
+		if p.match(lexer.RBRACE) {
+			return u.Node{Value: u.Cmd{Kind: u.INDEXSTART}}
+		}
 		expr := p.ParseExpr()
 		p.expect(lexer.RBRACE)
 		return u.Node{Value: u.Cmd{Kind: u.INDEXSTART}, Children: []u.Node{expr}}
 	case lexer.LBRACKET:
 		return p.parseDict()
-	// FIXME:
+	case lexer.IDENT:
+		return p.parseCall()
+	case lexer.KEYWORD:
+		if p.matchKeyword("try") {
+			return p.parseTry()
+		}
+		if p.matchKeyword("reduce") {
+			return p.parseReduce()
+		}
+		p.fail("unexpected token %s", p.advance())
+		return literal(nil)
+	case lexer.LOC:
+		t := p.advance()
+		line, _ := strconv.ParseInt(t.Value, 10, 64)
+		return literal(gqjson.ObjectOf("file", programFile, "line", line))
+	case lexer.VARIABLE:
+		return u.Node{Value: u.Cmd{Kind: u.VARIABLE, Ident: p.advance().Value}}
 	default:
-		return u.Node{}
+		p.fail("unexpected token %s", p.advance())
+		return literal(nil)
 	}
 }
 
-func (p *Parser) parseIndex() u.Node {
-	idxs := []u.IdxField{}
+// parseInterpolation parses the parts of `"a \(expr) b"`. Children alternate
+// between literal text and expressions, starting and ending with text, so
+// `"\(1)"` has the children "", 1 and "".
+func (p *Parser) parseInterpolation(format string) u.Node {
+	p.expect(lexer.QQSTRINGSTART)
+	n := u.Node{Value: u.Cmd{Kind: u.FORMAT, Ident: format}}
+	for {
+		switch p.peek().Kind {
+		case lexer.STRING:
+			n.Children = append(n.Children, literal(p.advance().Value))
+		case lexer.INTERPSTART:
+			p.advance()
+			n.Children = append(n.Children, p.ParseExpr())
+			p.expect(lexer.INTERPEND)
+		case lexer.QQSTRINGEND:
+			p.advance()
+			return n
+		default:
+			p.fail("unexpected token %s in string", p.advance())
+			return n
+		}
+	}
+}
+
+// parseFormat parses `@name`, which is a filter on its own, and `@name "..."`,
+// which applies the format to the interpolated values of the string.
+func (p *Parser) parseFormat() u.Node {
+	name := p.advance().Value
+	switch p.peek().Kind {
+	case lexer.STRING:
+		return literal(p.advance().Value)
+	case lexer.QQSTRINGSTART:
+		return p.parseInterpolation(name)
+	}
+	n := call("format")
+	n.Children = []u.Node{literal(name)}
+	return n
+}
+
+// parseTry parses `try body` and `try body catch handler`. Both bind as
+// tightly as a postfix term, so `try .a catch . | f` pipes the whole try.
+func (p *Parser) parseTry() u.Node {
+	n := u.Node{Value: u.Cmd{Kind: u.TRY}, Children: []u.Node{p.parsePostfix()}}
+	if p.matchKeyword("catch") {
+		n.Children = append(n.Children, p.parsePostfix())
+	}
+	return n
+}
+
+// parseReduce parses `reduce source as $name (init; update)`. The children
+// are the source, init and update expressions.
+func (p *Parser) parseReduce() u.Node {
+	source := p.parsePostfix()
+	if !p.matchKeyword("as") {
+		p.fail("unexpected token %s, expected as", p.peek())
+	}
+	name := p.expect(lexer.VARIABLE).Value
+	p.expect(lexer.LPAREN)
+	init := p.ParseExpr()
+	p.expect(lexer.SEMICOLON)
+	update := p.ParseExpr()
+	p.expect(lexer.RPAREN)
+	return u.Node{Value: u.Cmd{Kind: u.REDUCE, Ident: name}, Children: []u.Node{source, init, update}}
+}
+
+func (p *Parser) parseNumber() u.Node {
+	t := p.advance()
+	if !strings.ContainsAny(t.Value, ".eE") {
+		if n, err := strconv.ParseInt(t.Value, 10, 64); err == nil {
+			return literal(n)
+		}
+	}
+	// out of range numbers are ±Inf or 0, which jq keeps
+	f, err := strconv.ParseFloat(t.Value, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		p.fail("invalid number %s", t.Value)
+	}
+	return literal(f)
+}
 
+// parseCall parses builtin calls such as `empty` or `del(.a)`. Arguments are
+// separated by semicolons as in jq.
+func (p *Parser) parseCall() u.Node {
+	name := p.advance().Value
+	switch name {
+	case "null":
+		return literal(nil)
+	case "true":
+		return literal(true)
+	case "false":
+		return literal(false)
+	}
+
+	n := call(name)
+	if !p.match(lexer.LPAREN) {
+		return n
+	}
+	n.Children = append(n.Children, p.ParseExpr())
+	for p.match(lexer.SEMICOLON) {
+		n.Children = append(n.Children, p.ParseExpr())
+	}
+	p.expect(lexer.RPAREN)
+	return n
+}
+
+func (p *Parser) parseIndex() u.Node {
 	p.expect(lexer.DOT)
+	idxs := p.parseFields([]u.IdxField{}, true)
+	if len(idxs) == 0 {
+		idxs = append(idxs, u.IdxField{Kind: u.ROOT})
+	}
+	return u.Node{Value: u.Cmd{Kind: u.IDX, Fields: idxs}}
+}
+
+// parseFields reads index suffixes until a token that cannot continue the
+// path. Names are only accepted right after a dot, so that `.a and .b` is
+// not read as three fields.
+func (p *Parser) parseFields(idxs []u.IdxField, afterDot bool) []u.IdxField {
 	for {
 		tok := p.peek().Kind
 		if !isValidIndexStarter(tok) {
-			if len(idxs) == 0 {
-				idxs = append(idxs, u.IdxField{Kind: u.ROOT})
-			}
-			return u.Node{Value: u.Cmd{Kind: u.IDX, Fields: idxs}}
+			return idxs
 		}
 
 		switch tok {
 		case lexer.DOT:
+			if !isValidIndexStarter(p.peekAt(1).Kind) {
+				return idxs
+			}
 			p.advance()
+			afterDot = true
+			continue
 		case lexer.IDENT, lexer.STRING:
+			if !afterDot {
+				return idxs
+			}
 			t := p.advance()
 			idxs = append(idxs, u.IdxField{Kind: u.FIELD, Name: t.Value})
 		case lexer.LBRACE:
+			if !p.isStaticIndex() {
+				return idxs
+			}
 			p.advance()
 			switch p.peek().Kind {
 			case lexer.RBRACE:
 				p.advance()
 				idxs = append(idxs, u.IdxField{Kind: u.ARRAY})
-			case lexer.NUMBER:
-				t := p.advance()
+			case lexer.NUMBER, lexer.MINUS:
+				sign := 1
+				if p.match(lexer.MINUS) {
+					sign = -1
+				}
+				t := p.expect(lexer.NUMBER)
 				n, err := strconv.Atoi(t.Value)
 				if err != nil {
-					panic(err)
-				}
-				if !p.match(lexer.RBRACE) {
-					panic("need to close brace")
+					p.fail("invalid index %s", t.Value)
 				}
-				idxs = append(idxs, u.IdxField{Kind: u.IDX, Idx: n})
+				p.expect(lexer.RBRACE)
+				idxs = append(idxs, u.IdxField{Kind: u.IDX, Idx: sign * n})
 			case lexer.IDENT, lexer.STRING:
 				t := p.advance()
-				if !p.match(lexer.RBRACE) {
-					panic("need to close brace")
-				}
+				p.expect(lexer.RBRACE)
 				idxs = append(idxs, u.IdxField{Kind: u.FIELD, Name: t.Value})
-			// FIXME: break if not matching
 			default:
-				continue
+				p.fail("unexpected token %s in index", p.advance())
+				return idxs
 			}
-		// FIXME: break if not matching
-		default:
-			continue
 		}
+		afterDot = false
 	}
+}
 
+// isStaticIndex reports whether the `[` at the current position starts an
+// iteration, a number or a string index, which are stored as fields. Any
+// other index is an expression evaluated at runtime.
+func (p *Parser) isStaticIndex() bool {
+	switch p.peekAt(1).Kind {
+	case lexer.RBRACE:
+		return true
+	case lexer.NUMBER, lexer.IDENT, lexer.STRING:
+		return p.peekAt(2).Kind == lexer.RBRACE
+	case lexer.MINUS:
+		return p.peekAt(2).Kind == lexer.NUMBER && p.peekAt(3).Kind == lexer.RBRACE
+	}
+	return false
+}
+
+func (p *Parser) peekAt(offset int) lexer.Token {
+	if p.pos+offset >= len(p.ts) {
+		return lexer.Token{Kind: lexer.EOF}
+	}
+	return p.ts[p.pos+offset]
 }
 
 func (p *Parser) parseDict() u.Node {
 	p.expect(lexer.LBRACKET)
 	assignments := []u.Node{}
+	if p.match(lexer.RBRACKET) {
+		return u.Node{Value: u.Cmd{Kind: u.DICTSTART}, Children: assignments}
+	}
 
 	assignments = append(assignments, p.parseAssignment())
 
@@ -141,11 +530,34 @@ func (p *Parser) parseDict() u.Node {
 }
 
 func (p *Parser) parseAssignment() u.Node {
-	ident := p.expect(lexer.IDENT)
+	var ident lexer.Token
+	switch p.peek().Kind {
+	case lexer.VARIABLE:
+		// {$x} is a shorthand for {x: $x}.
+		name := p.advance().Value
+		value := u.Node{Value: u.Cmd{Kind: u.VARIABLE, Ident: name}}
+		return u.Node{Value: u.Cmd{Kind: u.ASSIGN, Ident: name}, Children: []u.Node{value}}
+	case lexer.IDENT, lexer.KEYWORD, lexer.STRING:
+		ident = p.advance()
+	default:
+		p.fail("unexpected token %s, expected object key", p.advance())
+	}
 	p.expect(lexer.COLON)
-	return u.Node{Value: u.Cmd{Kind: u.ASSIGN, Ident: ident.Value}, Children: []u.Node{p.ParseExpr()}}
+	return u.Node{Value: u.Cmd{Kind: u.ASSIGN, Ident: ident.Value}, Children: []u.Node{p.parsePipe(false)}}
 }
 
 func isValidIndexStarter(t lexer.TokenKind) bool {
 	return t == lexer.IDENT || t == lexer.STRING || t == lexer.LBRACE || t == lexer.DOT
 }
+
+func literal(v any) u.Node {
+	return u.Node{Value: u.Cmd{Kind: u.LITERAL, Literal: v}}
+}
+
+func call(name string) u.Node {
+	return u.Node{Value: u.Cmd{Kind: u.FUNC, Ident: name}}
+}
+
+func binop(op string, left, right u.Node) u.Node {
+	return u.Node{Value: u.Cmd{Kind: u.BINOP, Ident: op}, Children: []u.Node{left, right}}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	l "github.com/jmpargana/gq/internal/lexer"
@@ -361,6 +362,179 @@ func TestBuildTree(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "update with arithmetic",
+			cmds: []l.Token{
+				{Kind: l.DOT},
+				{Kind: l.IDENT, Value: "a"},
+				{Kind: l.SETPIPE},
+				{Kind: l.DOT},
+				{Kind: l.PLUS},
+				{Kind: l.NUMBER, Value: "1"},
+				{Kind: l.MULT},
+				{Kind: l.NUMBER, Value: "2.5"},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.UPDATE, Ident: "|="},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.FIELD, Name: "a"}}}},
+					{Value: u.Cmd{Kind: u.BINOP, Ident: "+"}, Children: []u.Node{
+						{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.ROOT}}}},
+						{Value: u.Cmd{Kind: u.BINOP, Ident: "*"}, Children: []u.Node{
+							{Value: u.Cmd{Kind: u.LITERAL, Literal: int64(1)}},
+							{Value: u.Cmd{Kind: u.LITERAL, Literal: 2.5}},
+						}},
+					}},
+				},
+			},
+		},
+		{
+			desc: "alternative binds looser than update",
+			cmds: []l.Token{
+				{Kind: l.DOT},
+				{Kind: l.IDENT, Value: "a"},
+				{Kind: l.SET},
+				{Kind: l.DOT},
+				{Kind: l.IDENT, Value: "b"},
+				{Kind: l.DEFINEDOR},
+				{Kind: l.IDENT, Value: "null"},
+				{Kind: l.COMMA},
+				{Kind: l.IDENT, Value: "del"},
+				{Kind: l.LPAREN},
+				{Kind: l.DOT},
+				{Kind: l.LBRACE},
+				{Kind: l.MINUS},
+				{Kind: l.NUMBER, Value: "1"},
+				{Kind: l.RBRACE},
+				{Kind: l.RPAREN},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.COMMA},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.ALT}, Children: []u.Node{
+						{Value: u.Cmd{Kind: u.UPDATE, Ident: "="}, Children: []u.Node{
+							{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.FIELD, Name: "a"}}}},
+							{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.FIELD, Name: "b"}}}},
+						}},
+						{Value: u.Cmd{Kind: u.LITERAL}},
+					}},
+					{Value: u.Cmd{Kind: u.FUNC, Ident: "del"}, Children: []u.Node{
+						{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.IDX, Idx: -1}}}},
+					}},
+				},
+			},
+		},
+		{
+			desc: "try catch binds tighter than pipe",
+			cmds: []l.Token{
+				{Kind: l.KEYWORD, Value: "try"},
+				{Kind: l.DOT},
+				{Kind: l.IDENT, Value: "a"},
+				{Kind: l.QUESTION},
+				{Kind: l.KEYWORD, Value: "catch"},
+				{Kind: l.DOT},
+				{Kind: l.PIPE},
+				{Kind: l.DOT},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.PIPE},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.TRY}, Children: []u.Node{
+						{Value: u.Cmd{Kind: u.TRY}, Children: []u.Node{
+							{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.FIELD, Name: "a"}}}},
+						}},
+						{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.ROOT}}}},
+					}},
+					{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.ROOT}}}},
+				},
+			},
+		},
+		{
+			desc: "interpolated string with format",
+			cmds: []l.Token{
+				{Kind: l.FORMAT, Value: "csv"},
+				{Kind: l.QQSTRINGSTART},
+				{Kind: l.STRING, Value: ""},
+				{Kind: l.INTERPSTART},
+				{Kind: l.DOT},
+				{Kind: l.INTERPEND},
+				{Kind: l.STRING, Value: "!"},
+				{Kind: l.QQSTRINGEND},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.FORMAT, Ident: "csv"},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.LITERAL, Literal: ""}},
+					{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.ROOT}}}},
+					{Value: u.Cmd{Kind: u.LITERAL, Literal: "!"}},
+				},
+			},
+		},
+		{
+			desc: "format applied to input",
+			cmds: []l.Token{
+				{Kind: l.FORMAT, Value: "base64"},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.FUNC, Ident: "format"},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.LITERAL, Literal: "base64"}},
+				},
+			},
+		},
+		{
+			desc: "variable binding and dynamic index",
+			cmds: []l.Token{
+				{Kind: l.DOT},
+				{Kind: l.IDENT, Value: "k"},
+				{Kind: l.KEYWORD, Value: "as"},
+				{Kind: l.VARIABLE, Value: "k"},
+				{Kind: l.PIPE},
+				{Kind: l.DOT},
+				{Kind: l.IDENT, Value: "a"},
+				{Kind: l.LBRACE},
+				{Kind: l.VARIABLE, Value: "k"},
+				{Kind: l.RBRACE},
+				{Kind: l.COMMA},
+				{Kind: l.VARIABLE, Value: "k"},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.AS, Ident: "k"},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.FIELD, Name: "k"}}}},
+					{Value: u.Cmd{Kind: u.COMMA}, Children: []u.Node{
+						{Value: u.Cmd{Kind: u.LOOKUP}, Children: []u.Node{
+							{Value: u.Cmd{Kind: u.IDX, Fields: []u.IdxField{{Kind: u.FIELD, Name: "a"}}}},
+							{Value: u.Cmd{Kind: u.VARIABLE, Ident: "k"}},
+						}},
+						{Value: u.Cmd{Kind: u.VARIABLE, Ident: "k"}},
+					}},
+				},
+			},
+		},
+		{
+			desc: "variable shorthand in object",
+			cmds: []l.Token{
+				{Kind: l.LBRACKET},
+				{Kind: l.VARIABLE, Value: "x"},
+				{Kind: l.RBRACKET},
+				{Kind: l.EOF},
+			},
+			pgr: u.Node{
+				Value: u.Cmd{Kind: u.DICTSTART},
+				Children: []u.Node{
+					{Value: u.Cmd{Kind: u.ASSIGN, Ident: "x"}, Children: []u.Node{
+						{Value: u.Cmd{Kind: u.VARIABLE, Ident: "x"}},
+					}},
+				},
+			},
+		},
 		// TODO: multiple chained u.PIPEs
 	}
 	for _, tC := range testCases {
@@ -373,3 +547,51 @@ func TestBuildTree(t *testing.T) {
 		})
 	}
 }
+
+func TestSyntaxErrors(t *testing.T) {
+	testCases := []struct {
+		desc, program, err string
+	}{
+		{
+			desc:    "dangling pipe",
+			program: `.a |`,
+			err:     "unexpected token end of program",
+		},
+		{
+			desc:    "unclosed call",
+			program: `del(.a`,
+			err:     "expected )",
+		},
+		{
+			desc:    "trailing tokens",
+			program: `.a )`,
+			err:     "unexpected token )",
+		},
+		{
+			desc:    "reduce without binding",
+			program: `reduce .[] (0; .)`,
+			err:     "expected as",
+		},
+		{
+			desc:    "binding without pipe",
+			program: `. as $x`,
+			err:     "unexpected token end of program, expected |",
+		},
+		{
+			desc:    "chained assignment",
+			program: `.a = .b = 1`,
+			err:     "unexpected token =",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := NewParser(l.Lex(tC.program)).Parse()
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("expected %s\ngot: %s\n", tC.err, err)
+			}
+		})
+	}
+}
@@ -14,12 +14,26 @@ const (
 	COMMA
 	ROOT
 	ARRAY
+	LITERAL
+	BINOP
+	AND
+	OR
+	ALT
+	UPDATE
+	FUNC
+	TRY
+	FORMAT
+	VARIABLE
+	AS
+	LOOKUP
+	REDUCE
 )
 
 type Cmd struct {
-	Kind   Kind
-	Fields []IdxField
-	Ident  string
+	Kind    Kind
+	Fields  []IdxField
+	Ident   string
+	Literal any
 }
 
 type IdxField struct {
@@ -136,6 +136,89 @@ func TestCLI_Root(t *testing.T) {
 `,
 			wantErr: "piped flattening",
 		},
+		{
+			desc:    "update assignment",
+			stdin:   `{"spec": {"replicas": 1}, "items": [{"status": "x", "n": 1}], "counter": 1}`,
+			program: `.spec.replicas = 3 | .items[] |= del(.status) | .counter += 1`,
+			wantOut: `{"spec": {"replicas": 3}, "items": [{"n": 1}], "counter": 2}
+`,
+			wantErr: "",
+		},
+		{
+			desc:    "invalid update",
+			stdin:   `{"a": "x"}`,
+			program: `.a -= 1`,
+			wantOut: "",
+			wantErr: "cannot be subtracted",
+		},
+		{
+			desc:    "try catch",
+			stdin:   `{"a": [1, "x"]}`,
+			program: `[.a[] | try (. + 1) catch .]`,
+			wantOut: `[2, "string (\"x\") and number (1) cannot be added"]
+`,
+			wantErr: "",
+		},
+		{
+			desc:    "uncaught error value",
+			stdin:   `{"a": 1}`,
+			program: `error({"code": 1})`,
+			wantOut: "",
+			wantErr: `{"code":1} (not a string)`,
+		},
+		{
+			desc:    "string interpolation and formats",
+			stdin:   `{"user": "bob", "row": [1, "a b"]}`,
+			program: `"hi \(.user)", (.row | @csv), @uri "https://x.org/?q=\(.row[1])"`,
+			wantOut: `"hi bob"
+"1,\"a b\""
+"https://x.org/?q=a%20b"
+`,
+			wantErr: "",
+		},
+		{
+			desc:    "regular expressions",
+			stdin:   `{"log": "user=bob took 12ms"}`,
+			program: `.log | capture("user=(?<user>\\w+)").user, gsub("\\d"; "#")`,
+			wantOut: `"bob"
+"user=bob took ##ms"
+`,
+			wantErr: "",
+		},
+		{
+			desc:    "string functions",
+			stdin:   `{"tags": ["Go", "JQ"], "path": "/usr/bin/"}`,
+			program: `([.tags[] | ascii_downcase] | join(",")), (.path | ltrimstr("/") | rtrimstr("/") | split("/"))`,
+			wantOut: `"go,jq"
+[
+  "usr",
+  "bin"
+]
+`,
+			wantErr: "",
+		},
+		{
+			desc:    "dates",
+			stdin:   `{"ts": "2015-03-05T23:51:47Z"}`,
+			program: `.ts | fromdate | ., strftime("%d/%m/%Y")`,
+			wantOut: `1425599507
+"05/03/2015"
+`,
+			wantErr: "",
+		},
+		{
+			desc:    "math",
+			stdin:   `{"latency": [1.25, 2.5, 4]}`,
+			program: `.latency[] | . * 2 | floor, sqrt`,
+			wantOut: `2
+1.5811388300841898
+5
+2.23606797749979
+8
+2.8284271247461903
+`,
+			wantErr: "",
+		},
 		{
 			desc:    "piped iter",
 			stdin:   `[[1,2], [3]]`,
@@ -188,6 +271,686 @@ func TestCLI_Root(t *testing.T) {
 	}
 }
 
+func TestCLI_Variables(t *testing.T) {
+	testCases := []struct {
+		desc, stdin      string
+		args             []string
+		wantOut, wantErr string
+	}{
+		{
+			desc:    "arg and argjson",
+			stdin:   `{"replicas": 1}`,
+			args:    []string{"--arg", "env", "prod", "--argjson", "n", `{"a": [2]}`, `{env: $env, replicas: (.replicas + $n.a[0])}`},
+			wantOut: `{"env": "prod", "replicas": 3}`,
+		},
+		{
+			desc:    "flags after the program",
+			stdin:   `{}`,
+			args:    []string{`$x`, "--arg", "x", "late"},
+			wantOut: `"late"`,
+		},
+		{
+			desc:    "positional args",
+			stdin:   `{}`,
+			args:    []string{`$ARGS`, "--arg", "x", "1", "--args", "a", "b"},
+			wantOut: `{"positional": ["a", "b"], "named": {"x": "1"}}`,
+		},
+		{
+			desc:    "positional json args",
+			stdin:   `{}`,
+			args:    []string{"--jsonargs", `$ARGS.positional`, "1", `{"a": null}`},
+			wantOut: `[1, {"a": null}]`,
+		},
+		{
+			desc:    "invalid argjson",
+			stdin:   `{}`,
+			args:    []string{"--argjson", "x", "{", `$x`},
+			wantErr: "invalid JSON text passed to --argjson",
+		},
+		{
+			desc:    "names with =",
+			stdin:   `{}`,
+			args:    []string{"--arg", "a=b", "v", `$ARGS.named`},
+			wantOut: `{"a=b": "v"}`,
+		},
+		{
+			desc:    "arg without a value",
+			args:    []string{"-n", "--arg", "x"},
+			wantErr: "--arg takes two parameters",
+		},
+		{
+			desc:    "rawfile without a value",
+			args:    []string{"-n", ".", "--rawfile", "x"},
+			wantErr: "--rawfile takes two parameters",
+		},
+		{
+			desc:    "undefined variable",
+			stdin:   `{}`,
+			args:    []string{`$x`},
+			wantErr: "$x is not defined",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(tC.stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			err := cmd.Run()
+			if tC.wantErr != "" {
+				if err == nil || !strings.Contains(stderr.String(), tC.wantErr) {
+					t.Fatalf("err: %v\nunexpected stderr output:\ngot: %s\nwanted: %s\n", err, stderr.String(), tC.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			var gotVal, wantVal any
+			if err := json.Unmarshal(stdout.Bytes(), &gotVal); err != nil {
+				t.Fatalf("invalid output %s: %v", stdout.String(), err)
+			}
+			json.Unmarshal([]byte(tC.wantOut), &wantVal)
+			if !reflect.DeepEqual(gotVal, wantVal) {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_FromFile(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "prog.jq")
+	script := "# pick the name\n.name # and upcase it\n| ascii_upcase, $x\n"
+	if err := os.WriteFile(program, []byte(script), 0o644); err != nil {
+		t.Fatalf("failed writing program: %v", err)
+	}
+
+	cmd := exec.Command(cliPath, "--arg", "x", "y", "-f", program)
+	cmd.Stdin = bytes.NewBufferString(`{"name": "gq"}`)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+	}
+	if want := "\"GQ\"\n\"y\"\n"; stdout.String() != want {
+		t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), want)
+	}
+
+	cmd = exec.Command(cliPath, "-f", filepath.Join(t.TempDir(), "missing.jq"))
+	cmd.Stdin = bytes.NewBufferString(`{}`)
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil || !strings.Contains(stderr.String(), "could not open") {
+		t.Fatalf("expected open error, got: %v\nstderr: %s", err, stderr.String())
+	}
+}
+
+func TestCLI_InputFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json":   `{"name": "a"}`,
+		"b.json":   "{\"name\": \"b\\\"c\"}\n2 \"three\"\n",
+		"bad.json": `{"name": "x"} [1,`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed writing %s: %v", name, err)
+		}
+	}
+
+	testCases := []struct {
+		desc             string
+		args             []string
+		wantOut, wantErr string
+		wantCode         int
+	}{
+		{
+			desc:    "files in order",
+			args:    []string{`.name? // .`, filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")},
+			wantOut: "\"a\"\n\"b\\\"c\"\n2\n\"three\"\n",
+		},
+		{
+			desc:    "flags between files",
+			args:    []string{filepath.Join(dir, "a.json"), "--arg", "x", "y", "-f", filepath.Join(dir, "prog.jq")},
+			wantOut: "\"y\"\n",
+		},
+		{
+			desc:    "reduce over inputs",
+			args:    []string{"-n", `reduce inputs as $x (0; . + 1)`, filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")},
+			wantOut: "4\n",
+		},
+		{
+			desc:    "input pulls the next value",
+			args:    []string{"-n", `[(input | .name), (input | .name), (input_filename | ltrimstr("` + dir + `/")), input_line_number]`, filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")},
+			wantOut: "[\n  \"a\",\n  \"b\\\"c\",\n  \"b.json\",\n  1\n]\n",
+		},
+		{
+			desc:    "parse error names the file",
+			args:    []string{`.name`, filepath.Join(dir, "bad.json")},
+			wantOut: "\"x\"\n",
+			wantErr: "bad.json",
+		},
+		{
+			desc:     "missing file",
+			args:     []string{`.name`, filepath.Join(dir, "missing.json"), filepath.Join(dir, "a.json")},
+			wantOut:  "\"a\"\n",
+			wantErr:  "could not open",
+			wantCode: 2,
+		},
+	}
+	if err := os.WriteFile(filepath.Join(dir, "prog.jq"), []byte(`$x`), 0o644); err != nil {
+		t.Fatalf("failed writing program: %v", err)
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			err := cmd.Run()
+			if tC.wantErr != "" {
+				if err == nil || !strings.Contains(stderr.String(), tC.wantErr) {
+					t.Fatalf("err: %v\nunexpected stderr output:\ngot: %s\nwanted: %s\n", err, stderr.String(), tC.wantErr)
+				}
+				if code := cmd.ProcessState.ExitCode(); tC.wantCode != 0 && code != tC.wantCode {
+					t.Fatalf("expected exit status %d, got %d", tC.wantCode, code)
+				}
+			} else if err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_InputModes(t *testing.T) {
+	testCases := []struct {
+		desc, stdin string
+		args        []string
+		wantOut     string
+	}{
+		{
+			desc:    "null input",
+			stdin:   `{"ignored": true}`,
+			args:    []string{"-n", `[., 1]`},
+			wantOut: "[\n  null,\n  1\n]\n",
+		},
+		{
+			desc:    "slurp",
+			stdin:   "{\"a\": 1}\n{\"a\": 2}\n",
+			args:    []string{"-s", `[.[].a]`},
+			wantOut: "[\n  1,\n  2\n]\n",
+		},
+		{
+			desc:    "raw lines",
+			stdin:   "a,b\nc\n\nd",
+			args:    []string{"-R", `length`},
+			wantOut: "3\n1\n0\n1\n",
+		},
+		{
+			desc:    "raw slurp",
+			stdin:   "a\nb\n",
+			args:    []string{"-R", "-s", `.`},
+			wantOut: "\"a\\nb\\n\"\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(tC.stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_ExitStatus(t *testing.T) {
+	testCases := []struct {
+		desc, stdin string
+		args        []string
+		code        int
+		wantErr     string
+	}{
+		{desc: "success", stdin: `{"ok": true}`, args: []string{"-e", `.ok`}, code: 0},
+		{desc: "last output false", stdin: `{"ok": false}`, args: []string{"-e", `true, .ok`}, code: 1},
+		{desc: "last output null", stdin: `{}`, args: []string{"--exit-status", `.ok`}, code: 1},
+		{desc: "no output", stdin: `{}`, args: []string{"-e", `empty`}, code: 4},
+		{desc: "false without -e", stdin: `{}`, args: []string{`false`}, code: 0},
+		{desc: "usage error", stdin: `{}`, args: []string{"--nope", `.`}, code: 2, wantErr: "unknown flag"},
+		{desc: "compile error", stdin: `{}`, args: []string{`.a +`}, code: 3, wantErr: "syntax error"},
+		{desc: "runtime error", stdin: `{"a": "x"} {"a": 1}`, args: []string{`.a + 1`}, code: 5, wantErr: "cannot be added"},
+		{desc: "halt", stdin: `{}`, args: []string{"-e", `null, halt`}, code: 0},
+		{desc: "halt_error", stdin: `{}`, args: []string{`"stopped\n" | halt_error(7)`}, code: 7, wantErr: "stopped\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(tC.stdin)
+
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+
+			code := 0
+			if err := cmd.Run(); err != nil {
+				exitErr, ok := err.(*exec.ExitError)
+				if !ok {
+					t.Fatalf("failed running command: %v", err)
+				}
+				code = exitErr.ExitCode()
+			}
+			if code != tC.code {
+				t.Fatalf("expected exit status %d, got %d\nstderr: %s", tC.code, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tC.wantErr) {
+				t.Fatalf("unexpected stderr output:\ngot: %s\nwanted: %s\n", stderr.String(), tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestCLI_Colors(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		args    []string
+		env     []string
+		wantOut string
+	}{
+		{desc: "not a terminal", args: []string{`.a`}, wantOut: "1\n"},
+		{desc: "forced", args: []string{"-C", `.a`}, wantOut: "\x1b[0;39m1\x1b[0m\n"},
+		{desc: "forced over NO_COLOR", args: []string{"-C", `.a`}, env: []string{"NO_COLOR=1"}, wantOut: "\x1b[0;39m1\x1b[0m\n"},
+		{desc: "monochrome wins", args: []string{"-C", "-M", `.a`}, wantOut: "1\n"},
+		{desc: "custom colors", args: []string{"-C", `.a`}, env: []string{"GQ_COLORS=:::0;31"}, wantOut: "\x1b[0;31m1\x1b[0m\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(`{"a": 1}`)
+			cmd.Env = append(os.Environ(), tC.env...)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%q\nwanted:%q\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_ASCIIOutput(t *testing.T) {
+	cmd := exec.Command(cliPath, "-a", `.name, .emoji`)
+	cmd.Stdin = bytes.NewBufferString(`{"name": "Zoë", "emoji": "\ud83d\ude80"}`)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+	}
+	if want := `"Zo\u00eb"` + "\n" + `"\ud83d\ude80"` + "\n"; stdout.String() != want {
+		t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), want)
+	}
+}
+
+func TestCLI_Seq(t *testing.T) {
+	cmd := exec.Command(cliPath, "--seq", `.a`)
+	cmd.Stdin = bytes.NewBufferString("\x1e{\"a\": 1}\n\x1e{\"a\": \n\x1e{\"a\": [2]}\n")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+	}
+	if want := "\x1e1\n\x1e[\n  2\n]\n"; stdout.String() != want {
+		t.Fatalf("unexpected output:\ngot:%q\nwanted:%q\n", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "ignoring parse error") {
+		t.Fatalf("expected a warning for the truncated record, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Stream(t *testing.T) {
+	testCases := []struct {
+		desc, stdin string
+		args        []string
+		wantOut     string
+	}{
+		{
+			desc:    "leaf events",
+			stdin:   `{"a": [1, {"b": 2}]} 3`,
+			args:    []string{"--stream", `select(length == 2) | .[1]`},
+			wantOut: "1\n2\n3\n",
+		},
+		{
+			desc:    "elements of a top-level array",
+			stdin:   `[{"a": 1}, {"a": 2}]`,
+			args:    []string{"-n", "--stream", `fromstream(1 | truncate_stream(inputs)) | .a`},
+			wantOut: "1\n2\n",
+		},
+		{
+			desc:    "errors as events",
+			stdin:   `{"a": [1, 2`,
+			args:    []string{"-n", "--stream-errors", `reduce inputs as $e (null; $e) | .[1]`},
+			wantOut: "[\n  \"a\",\n  1\n]\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(tC.stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_YAML(t *testing.T) {
+	stdin := "defaults: &defaults\n  replicas: 1\n  image: web\nprod:\n  <<: *defaults\n  replicas: 3\n---\nprod: {image: api}\n"
+	testCases := []struct {
+		desc    string
+		args    []string
+		wantOut string
+	}{
+		{
+			desc:    "yaml to json",
+			args:    []string{"--input-format", "yaml", `.prod.image`},
+			wantOut: "\"web\"\n\"api\"\n",
+		},
+		{
+			desc:    "yaml command",
+			args:    []string{"yaml", `.prod | {replicas: .replicas}`},
+			wantOut: "replicas: 3\n---\nreplicas: null\n",
+		},
+		{
+			desc:    "json output from the yaml command",
+			args:    []string{"yaml", "--output-format", "json", `.prod.replicas`},
+			wantOut: "3\nnull\n",
+		},
+		{
+			desc:    "keys keep their order",
+			args:    []string{"yaml", `.prod + {name: "web"}`},
+			wantOut: "replicas: 3\nimage: web\nname: web\n---\nimage: api\nname: web\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_TOML(t *testing.T) {
+	stdin := "[package]\nname = \"gq\"\nreleased = 2024-01-02\n\n[[bin]]\nname = \"gq\"\n"
+	testCases := []struct {
+		desc     string
+		args     []string
+		wantOut  string
+		wantCode int
+	}{
+		{
+			desc:    "toml to json",
+			args:    []string{"--input-format", "toml", `.package.released`},
+			wantOut: "\"2024-01-02\"\n",
+		},
+		{
+			desc:    "toml command",
+			args:    []string{"toml", `.package.name = "gq2" | del(.bin)`},
+			wantOut: "[package]\nname = \"gq2\"\nreleased = \"2024-01-02\"\n",
+		},
+		{
+			desc:     "top-level array",
+			args:     []string{"toml", `.bin`},
+			wantCode: 5,
+		},
+		{
+			desc:     "null",
+			args:     []string{"toml", `.package.name = null`},
+			wantCode: 5,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			code := 0
+			if err := cmd.Run(); err != nil {
+				exitErr, ok := err.(*exec.ExitError)
+				if !ok {
+					t.Fatalf("failed running command: %v", err)
+				}
+				code = exitErr.ExitCode()
+			}
+			if code != tC.wantCode {
+				t.Fatalf("expected exit status %d, got %d\nstderr: %s", tC.wantCode, code, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_CSV(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		args    []string
+		stdin   string
+		wantOut string
+	}{
+		{
+			desc:    "rows as objects",
+			args:    []string{"--input-format", "csv", `.name`},
+			stdin:   "id,name\n1,\"Smith, J\"\n2,Doe\n",
+			wantOut: "\"Smith, J\"\n\"Doe\"\n",
+		},
+		{
+			desc:    "type inference",
+			args:    []string{"--input-format", "csv", "--infer-types", `select(.id > 1) | .score`},
+			stdin:   "id,score\n1,\n2,\n3,4.5\n",
+			wantOut: "null\n4.5\n",
+		},
+		{
+			desc:    "tsv without header",
+			args:    []string{"--input-format", "tsv", "--no-header", `.[1]`},
+			stdin:   "a\t\"b\n",
+			wantOut: "\"\\\"b\"\n",
+		},
+		{
+			desc:    "delimiter",
+			args:    []string{"--input-format", "csv", "--delimiter", ";", "-s", `[.[].b]`},
+			stdin:   "a;b\n1;2\n",
+			wantOut: "[\n  \"2\"\n]\n",
+		},
+		{
+			desc:    "header order in a table",
+			args:    []string{"--input-format", "csv", "--output-format", "table", "."},
+			stdin:   "zone,id,name\neu,1,web\n",
+			wantOut: "zone  id  name\n----  --  ----\neu    1   web\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(tC.stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_Tables(t *testing.T) {
+	stdin := `{"name": "gq", "stars": 12} {"name": "jq", "stars": 30000, "lang": "C"}`
+	testCases := []struct {
+		desc    string
+		format  string
+		wantOut string
+	}{
+		{
+			desc:    "table",
+			format:  "table",
+			wantOut: "name  stars  lang\n----  -----  ----\ngq       12\njq    30000  C\n",
+		},
+		{
+			desc:    "markdown",
+			format:  "markdown",
+			wantOut: "| name | stars | lang |\n| ---- | ----: | ---- |\n| gq   |    12 |      |\n| jq   | 30000 | C    |\n",
+		},
+		{
+			desc:    "csv",
+			format:  "csv",
+			wantOut: "name,stars,lang\ngq,12,\njq,30000,C\n",
+		},
+		{
+			desc:    "tsv",
+			format:  "tsv",
+			wantOut: "name\tstars\tlang\ngq\t12\t\njq\t30000\tC\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, "--output-format", tC.format, ".")
+			cmd.Stdin = bytes.NewBufferString(stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_XML(t *testing.T) {
+	stdin := `<soap:Envelope xmlns:soap="urn:soap"><soap:Body><r id="7"><v>a</v><v>b</v></r></soap:Body></soap:Envelope>`
+	testCases := []struct {
+		desc    string
+		args    []string
+		wantOut string
+	}{
+		{
+			desc:    "prefixed names",
+			args:    []string{"--input-format", "xml", `.["soap:Envelope"]["soap:Body"].r["@id"]`},
+			wantOut: "\"7\"\n",
+		},
+		{
+			desc:    "stripped namespaces and repeated elements",
+			args:    []string{"--input-format", "xml", "--xml-strip-namespaces", `.Envelope.Body.r.v[]`},
+			wantOut: "\"a\"\n\"b\"\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := exec.Command(cliPath, tC.args...)
+			cmd.Stdin = bytes.NewBufferString(stdin)
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			if stdout.String() != tC.wantOut {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted:%s\n", stdout.String(), tC.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLI_Binary(t *testing.T) {
+	for _, format := range []string{"msgpack", "cbor"} {
+		t.Run(format, func(t *testing.T) {
+			encode := exec.Command(cliPath, "--output-format", format, ".")
+			encode.Stdin = bytes.NewBufferString(`{"id": 7, "tags": ["a", null]} "next"`)
+			var encoded, stderr bytes.Buffer
+			encode.Stdout = &encoded
+			encode.Stderr = &stderr
+			if err := encode.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+
+			decode := exec.Command(cliPath, "--input-format", format, ".tags?, .id?, .")
+			decode.Stdin = &encoded
+			var stdout bytes.Buffer
+			decode.Stdout = &stdout
+			decode.Stderr = &stderr
+			if err := decode.Run(); err != nil {
+				t.Fatalf("err: %s\nstderr: %s", err, stderr.String())
+			}
+			want := "[\n  \"a\",\n  null\n]\n7\n"
+			if got := stdout.String(); !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "\"next\"\n") {
+				t.Fatalf("unexpected output:\ngot:%s\nwanted it to start with:%s\n", got, want)
+			}
+		})
+	}
+}
+
 func TestCLI_RootTestDataString(t *testing.T) {
 	testCases := []struct {
 		desc, query, file string